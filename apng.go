@@ -0,0 +1,162 @@
+// animated PNG output assembled from frames encoded by image/png
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// APNG blend operations, SOURCE replaces the frame's rectangle and OVER
+// composites the frame onto it
+const (
+	apngBlendSource = 0
+	apngBlendOver   = 1
+)
+
+// APNG delays are 16 bit fractions, kept in hundredths of a second
+const maxAPNGDelay = 65535
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// apngFrame is one stored frame, placed at its bounds on the canvas
+type apngFrame struct {
+	img   *image.RGBA
+	delay int
+	blend byte
+}
+
+// keepAlpha stops image/png from dropping the alpha channel of an opaque
+// frame, so every frame of an animation has the same color type
+type keepAlpha struct{ *image.RGBA }
+
+func (keepAlpha) Opaque() bool { return false }
+
+// pngChunks encodes img with image/png and returns its header and the
+// concatenated image data
+func pngChunks(img *image.RGBA, alpha bool) (header, data []byte, err error) {
+	var buf bytes.Buffer
+	var m image.Image = img
+	if alpha && img.Opaque() {
+		m = keepAlpha{img}
+	}
+	if err := png.Encode(&buf, m); err != nil {
+		return nil, nil, err
+	}
+	raw := buf.Bytes()[len(pngSignature):]
+	for len(raw) >= 12 {
+		length := binary.BigEndian.Uint32(raw)
+		chunk := raw[8 : 8+length]
+		switch string(raw[4:8]) {
+		case "IHDR":
+			header = chunk
+		case "IDAT":
+			data = append(data, chunk...)
+		}
+		raw = raw[12+length:]
+	}
+	if header == nil || data == nil {
+		return nil, nil, errors.New("unexpected PNG encoding")
+	}
+	return header, data, nil
+}
+
+// writeChunk writes a PNG chunk with its length and checksum
+func writeChunk(w io.Writer, kind string, data []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	_, err := w.Write(slices.Concat(length[:], []byte(kind), data, binary.BigEndian.AppendUint32(nil, crc.Sum32())))
+	return err
+}
+
+// saveAPNG writes the frames as an animated PNG in the configured playback
+// order. Unlike GIFs it keeps every color and the full alpha channel
+func saveAPNG(frames, _ []*image.RGBA, delays []int, config Config, _ []color.RGBA, text string) error {
+	if err := os.MkdirAll(config.OutputDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	order, delays := playbackOrder(delays, config)
+	stored := make([]apngFrame, len(order))
+	alpha := false
+	for i, frame := range order {
+		img, blend := frames[frame], byte(apngBlendSource)
+		if i > 0 && config.OptimizeFrames {
+			var over bool
+			img, over = frameDelta(frames[order[i-1]], img, 1)
+			if over {
+				blend = apngBlendOver
+			}
+		}
+		stored[i] = apngFrame{img: img, delay: min(delays[i], maxAPNGDelay), blend: blend}
+		alpha = alpha || !img.Opaque()
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	// the sequence numbers count the frame control and data chunks together
+	sequence := uint32(0)
+	for i, frame := range stored {
+		header, data, err := pngChunks(frame.img, alpha)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			if err := writeChunk(&out, "IHDR", header); err != nil {
+				return err
+			}
+			control := binary.BigEndian.AppendUint32(nil, uint32(len(stored)))
+			control = binary.BigEndian.AppendUint32(control, uint32(config.Loop))
+			if err := writeChunk(&out, "acTL", control); err != nil {
+				return err
+			}
+		}
+
+		r := frame.img.Rect
+		control := binary.BigEndian.AppendUint32(nil, sequence)
+		for _, v := range []int{r.Dx(), r.Dy(), r.Min.X, r.Min.Y} {
+			control = binary.BigEndian.AppendUint32(control, uint32(v))
+		}
+		control = binary.BigEndian.AppendUint16(control, uint16(frame.delay))
+		control = binary.BigEndian.AppendUint16(control, 100)
+		// frames stay on the canvas, dispose op none
+		control = append(control, 0, frame.blend)
+		sequence++
+		if err := writeChunk(&out, "fcTL", control); err != nil {
+			return err
+		}
+
+		// the first frame doubles as the still image of viewers without APNG
+		if i == 0 {
+			err = writeChunk(&out, "IDAT", data)
+		} else {
+			err = writeChunk(&out, "fdAT", append(binary.BigEndian.AppendUint32(nil, sequence), data...))
+			sequence++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := writeChunk(&out, "IEND", nil); err != nil {
+		return err
+	}
+
+	fileName := filepath.Join(config.OutputDir, sanitizeFilename(text)+".png")
+	if err := os.WriteFile(fileName, out.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("✅ APNG animation successfully created: %s\n", fileName)
+	return nil
+}
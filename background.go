@@ -8,8 +8,25 @@ import (
 	"math"
 )
 
+// BackgroundParams carries the render settings shared by every generator
+type BackgroundParams struct {
+	// PixelScale is the number of output pixels per logical pixel, so
+	// patterns keep their size when rendering at a higher resolution
+	PixelScale float64
+	// seed for the randomized generators
+	Seed int64
+	// colors for the palette driven generators
+	Palette []color.RGBA
+	// generator specific values, validated against the generator's ParamSpecs
+	Values map[string]string
+	// make the output wrap seamlessly at its edges
+	Tileable bool
+	// progress through a looping animation in [0, 1), 0 for still images
+	Time float64
+}
+
 // defines the signature for background generation functions
-type BackgroundGenFunc func(w, h int) *image.RGBA
+type BackgroundGenFunc func(w, h int, params BackgroundParams) *image.RGBA
 
 // Enhanced Studio Ghibli color palette
 var studioPalette = []color.RGBA{
@@ -57,36 +74,22 @@ var studioPalette = []color.RGBA{
 // 	{173, 216, 230, 255}, // Light Blue
 // }
 
-var predefinedPalette color.Palette
-
-func init() {
-	initializePalette()
-}
-
-func initializePalette() {
-	// Add black and white first
-	predefinedPalette = append(predefinedPalette, color.Black, color.White)
-
-	// Add Studio Ghibli colors
-	for _, c := range studioPalette {
-		predefinedPalette = append(predefinedPalette, c)
-		if len(predefinedPalette) >= maxPaletteSize {
-			break
-		}
-	}
-
-	// fmt.Printf("Initialized GIF palette with %d colors.", len(predefinedPalette))
+// transparent canvas, only the text ends up in the output
+func generateTransparentBackground(w, h int, _ BackgroundParams) *image.RGBA {
+	return image.NewRGBA(image.Rect(0, 0, w, h))
 }
 
-// create XOR pattern
-func generatePatternBackground(w, h int) *image.RGBA {
+// create XOR pattern, animated it runs through all 256 of its shades once
+// per loop
+func generatePatternBackground(w, h int, params BackgroundParams) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
-	for y := range h {
-		for x := range w {
-			v := uint8(x ^ y + (x+y)/2)
-			img.Set(x, y, color.RGBA{v, 255 - v, (v * 3) % 255, 255})
-		}
-	}
+	shift := int(math.Round(params.Time * 256))
+	fillPixels(img, func(x, y int) color.RGBA {
+		lx := int(float64(x) / params.PixelScale)
+		ly := int(float64(y) / params.PixelScale)
+		v := uint8(lx ^ ly + (lx+ly)/2 + shift)
+		return color.RGBA{v, 255 - v, (v * 3) % 255, 255}
+	})
 	return img
 }
 
@@ -100,133 +103,212 @@ func interpolateColor(c1, c2 color.RGBA, t float64) color.RGBA {
 	}
 }
 
-// create pseudo-perlin noise background
-func generatePerlinLikeBackground(w, h int) *image.RGBA {
+// samplePalette maps t in [0, 1] onto a smooth ramp through the palette
+func samplePalette(palette []color.RGBA, t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+	pos := t * float64(len(palette)-1)
+	idx := int(pos)
+	if idx >= len(palette)-1 {
+		return palette[len(palette)-1]
+	}
+	return interpolateColor(palette[idx], palette[idx+1], pos-float64(idx))
+}
+
+// noiseBackground shades each pixel through the palette using fractal noise
+func noiseBackground(w, h int, params BackgroundParams, noise NoiseFunc) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	opts := params.noiseOptions()
+	scale := opts.Scale * params.PixelScale
+	var field NoiseFunc = func(x, y float64) float64 { return fbm(noise, x, y, opts) }
+	if params.Tileable {
+		field = periodicField(field, float64(w)/scale, float64(h)/scale)
+	}
+	field = loopedField(field, params.Time, noiseDrift, noiseDrift/2)
 
-	for y := range h {
-		for x := range w {
-			val1 := math.Sin(float64(x)/50.0) + math.Cos(float64(y)/40.0)
-			val2 := math.Sin(float64(x)/25.0) + math.Cos(float64(y)/20.0)*0.5
-			val3 := math.Sin(float64(x)/12.5) + math.Cos(float64(y)/10.0)*0.25
-			val4 := math.Sin(float64(x)/80.0) + math.Cos(float64(y)/60.0)*1.5
+	fillPixels(img, func(x, y int) color.RGBA {
+		v := field(float64(x)/scale, float64(y)/scale)
+		return samplePalette(params.Palette, 0.5+v)
+	})
+	return img
+}
 
-			combinedNoise := val1 + val2 + val3 + val4
-			normalizedNoise := math.Max(0, math.Min(1, (combinedNoise+4.0)/8.0))
+// fractal Perlin noise background
+func generatePerlinBackground(w, h int, params BackgroundParams) *image.RGBA {
+	return noiseBackground(w, h, params, newPerlinNoise(params.Seed).noise)
+}
 
-			paletteIndex := normalizedNoise * float64(len(studioPalette)-1)
-			index := int(paletteIndex)
-			fraction := paletteIndex - float64(index)
+// fractal Perlin noise with domain warping for soft, flowing shapes
+func generatePerlinWarpedBackground(w, h int, params BackgroundParams) *image.RGBA {
+	perlin := newPerlinNoise(params.Seed)
+	warpOpts := params.noiseOptions()
+	warpOpts.Octaves = min(warpOpts.Octaves, 3)
+	strength := params.Float("warp")
+
+	// the warp carries the detail, so the outer noise is a single octave
+	var warped NoiseFunc = func(x, y float64) float64 {
+		qx := fbm(perlin.noise, x+5.2, y+1.3, warpOpts)
+		qy := fbm(perlin.noise, x+1.7, y+9.2, warpOpts)
+		return perlin.noise(x+strength*qx, y+strength*qy)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	scale := warpOpts.Scale * params.PixelScale
+	if params.Tileable {
+		warped = periodicField(warped, float64(w)/scale, float64(h)/scale)
+	}
+	warped = loopedField(warped, params.Time, noiseDrift, noiseDrift/2)
 
-			var finalColor color.RGBA
-			if index >= len(studioPalette)-1 {
-				finalColor = studioPalette[len(studioPalette)-1]
-			} else {
-				finalColor = interpolateColor(studioPalette[index], studioPalette[index+1], fraction)
-			}
+	fillPixels(img, func(x, y int) color.RGBA {
+		v := warped(float64(x)/scale, float64(y)/scale)
+		return samplePalette(params.Palette, 0.5+v)
+	})
+	return img
+}
 
-			img.Set(x, y, finalColor)
+// fractal OpenSimplex2 noise background
+func generateSimplexBackground(w, h int, params BackgroundParams) *image.RGBA {
+	return noiseBackground(w, h, params, newSimplexNoise(params.Seed).noise)
+}
+
+// create pseudo-perlin noise background
+func generatePerlinLikeBackground(w, h int, params BackgroundParams) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	palette := params.Palette
+	scale := params.Float("scale") * params.PixelScale
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		lx, ly := float64(x)/scale, float64(y)/scale
+		val1 := math.Sin(lx/50.0) + math.Cos(ly/40.0)
+		val2 := math.Sin(lx/25.0) + math.Cos(ly/20.0)*0.5
+		val3 := math.Sin(lx/12.5) + math.Cos(ly/10.0)*0.25
+		val4 := math.Sin(lx/80.0) + math.Cos(ly/60.0)*1.5
+
+		combinedNoise := val1 + val2 + val3 + val4
+		normalizedNoise := math.Max(0, math.Min(1, (combinedNoise+4.0)/8.0))
+
+		paletteIndex := normalizedNoise * float64(len(palette)-1)
+		index := int(paletteIndex)
+		fraction := paletteIndex - float64(index)
+
+		var finalColor color.RGBA
+		if index >= len(palette)-1 {
+			finalColor = palette[len(palette)-1]
+		} else {
+			finalColor = interpolateColor(palette[index], palette[index+1], fraction)
 		}
-	}
+		return finalColor
+	})
 	return img
 }
 
 // Significantly smoother Perlin-like noise using higher precision
-func generatePerlinSmootherBackground(w, h int) *image.RGBA {
+func generatePerlinSmootherBackground(w, h int, params BackgroundParams) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	palette := params.Palette
+	octaves := params.Int("octaves")
+	lacunarity, persistence := params.Float("lacunarity"), params.Float("persistence")
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		fx, fy := float64(x)/float64(w), float64(y)/float64(h)
 
-	for y := range h {
-		for x := range w {
-			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
-
-			// Multi-octave noise with smoother interpolation
-			noise := 0.0
-			amplitude := 1.0
-			frequency := 1.0
-
-			// 6 octaves for ultra-smooth result
-			for range 6 {
-				n1 := math.Sin(fx*frequency*math.Pi*4) * math.Cos(fy*frequency*math.Pi*3)
-				n2 := math.Cos(fx*frequency*math.Pi*3) * math.Sin(fy*frequency*math.Pi*4)
-				n3 := math.Sin((fx + fy) * frequency * math.Pi * 2)
-				n4 := math.Cos((fx - fy) * frequency * math.Pi * 2.5)
-
-				octaveNoise := (n1 + n2 + n3 + n4) / 4.0
-				noise += amplitude * octaveNoise
-
-				amplitude *= 0.6 // Gentler amplitude decrease
-				frequency *= 1.8 // Gentler frequency increase
-			}
-
-			// Smooth normalization
-			normalized := (math.Tanh(noise) + 1.0) / 2.0 // Tanh for smoother distribution
-
-			// Map to enhanced palette
-			colorIndex := normalized * float64(len(studioPalette)-1)
-			idx := int(colorIndex)
-			frac := colorIndex - float64(idx)
-
-			if idx >= len(studioPalette)-1 {
-				img.Set(x, y, studioPalette[len(studioPalette)-1])
-			} else {
-				// Smooth color interpolation
-				interpolated := interpolateColor(studioPalette[idx], studioPalette[idx+1], frac)
-				img.Set(x, y, interpolated)
-			}
+		// Multi-octave noise with smoother interpolation
+		noise := 0.0
+		amplitude := 1.0
+		frequency := 1.0
+
+		for range octaves {
+			n1 := math.Sin(fx*frequency*math.Pi*4) * math.Cos(fy*frequency*math.Pi*3)
+			n2 := math.Cos(fx*frequency*math.Pi*3) * math.Sin(fy*frequency*math.Pi*4)
+			n3 := math.Sin((fx + fy) * frequency * math.Pi * 2)
+			n4 := math.Cos((fx - fy) * frequency * math.Pi * 2.5)
+
+			octaveNoise := (n1 + n2 + n3 + n4) / 4.0
+			noise += amplitude * octaveNoise
+
+			amplitude *= persistence
+			frequency *= lacunarity
 		}
-	}
+
+		// Smooth normalization
+		normalized := (math.Tanh(noise) + 1.0) / 2.0 // Tanh for smoother distribution
+
+		// Map to enhanced palette
+		colorIndex := normalized * float64(len(palette)-1)
+		idx := int(colorIndex)
+		frac := colorIndex - float64(idx)
+
+		if idx >= len(palette)-1 {
+			return palette[len(palette)-1]
+		}
+		// Smooth color interpolation
+		return interpolateColor(palette[idx], palette[idx+1], frac)
+	})
 	return img
 }
 
 // creates a radial pattern
-func generateRadialPatternBackground(w, h int) *image.RGBA {
+func generateRadialPatternBackground(w, h int, params BackgroundParams) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
 
-	centerX, centerY := float64(w)/2.0, float64(h)/2.0
+	centerX, centerY := float64(w)*params.Float("cx"), float64(h)*params.Float("cy")
+	spacing := params.Float("spacing")
+	spokes := float64(params.Int("spokes"))
+	// one full turn over a loop, which whole spokes repeat exactly
+	turn := 2 * math.Pi * params.Time
 
-	for y := range h {
-		for x := range w {
-			dx := float64(x) - centerX
-			dy := float64(y) - centerY
+	fillPixels(img, func(x, y int) color.RGBA {
+		dx := float64(x) - centerX
+		dy := float64(y) - centerY
 
-			dist := math.Sqrt(dx*dx + dy*dy)
-			angle := math.Atan2(dy, dx)
+		dist := math.Sqrt(dx*dx+dy*dy) / params.PixelScale / spacing
+		angle := (math.Atan2(dy, dx) + turn) * spokes
 
-			r := uint8(math.Abs(math.Sin(dist/20.0+angle*5.0) * 255.0))
-			g := uint8(math.Abs(math.Cos(dist/30.0-angle*3.0) * 255.0))
-			b := uint8(math.Abs(math.Sin(dist/40.0+angle*7.0) * 255.0))
+		r := uint8(math.Abs(math.Sin(dist/20.0+angle*5.0) * 255.0))
+		g := uint8(math.Abs(math.Cos(dist/30.0-angle*3.0) * 255.0))
+		b := uint8(math.Abs(math.Sin(dist/40.0+angle*7.0) * 255.0))
 
-			img.Set(x, y, color.RGBA{r, g, b, 255})
-		}
-	}
+		return color.RGBA{r, g, b, 255}
+	})
 	return img
 }
 
 // creates diagonal grid pattern
-func generateDiagonalGridBackground(w, h int) *image.RGBA {
+func generateDiagonalGridBackground(w, h int, params BackgroundParams) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
-	gridSize := 50
-
-	for y := range h {
-		for x := range w {
-			patternVal := (x + y) % gridSize
-
-			colorIdx := ((x + y) / gridSize) % len(studioPalette)
-			baseColor := studioPalette[colorIdx]
-
-			if patternVal < gridSize/2 {
-				img.Set(x, y, baseColor)
-			} else {
-				// Slightly darker version
-				darkColor := color.RGBA{
-					uint8(float64(baseColor.R) * 0.7),
-					uint8(float64(baseColor.G) * 0.7),
-					uint8(float64(baseColor.B) * 0.7),
-					255,
-				}
-				img.Set(x, y, darkColor)
-			}
-		}
+	gridSize := params.Float("grid")
+	shade := params.Float("shade")
+	palette := params.Colors("colors", params.Palette)
+
+	// project onto the stripe normal, snapped so 45 degrees gives exactly x+y
+	theta := params.Float("angle") * math.Pi / 180
+	kx := math.Round(math.Cos(theta)*math.Sqrt2*1e9) / 1e9
+	ky := math.Round(math.Sin(theta)*math.Sqrt2*1e9) / 1e9
+	if params.Tileable {
+		period := gridSize * float64(len(palette))
+		kx, ky = fitDirection(kx, ky, float64(w)/params.PixelScale, float64(h)/params.PixelScale, period)
 	}
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		// scrolls through every color once over a loop
+		pos := (float64(x)*kx+float64(y)*ky)/params.PixelScale - params.Time*gridSize*float64(len(palette))
+		band := math.Floor(pos / gridSize)
+		patternVal := pos - band*gridSize
+
+		colorIdx := int(band) % len(palette)
+		if colorIdx < 0 {
+			colorIdx += len(palette)
+		}
+		baseColor := palette[colorIdx]
+
+		if patternVal < gridSize/2 {
+			return baseColor
+		}
+		// Slightly darker version
+		return color.RGBA{
+			uint8(float64(baseColor.R) * shade),
+			uint8(float64(baseColor.G) * shade),
+			uint8(float64(baseColor.B) * shade),
+			255,
+		}
+	})
 	return img
 }
@@ -0,0 +1,74 @@
+// background motion across the frames of a looping animation
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// noise units a flowing noise background drifts over one loop, one unit
+// being the size of its largest features
+const noiseDrift = 2
+
+// loopedField drifts the field by dx, dy over a loop and crossfades the
+// drifted copy back into the start, so time 1 matches time 0. Dividing by
+// the weights' length keeps the contrast even through the crossfade
+func loopedField(field NoiseFunc, t, dx, dy float64) NoiseFunc {
+	if t == 0 {
+		return field
+	}
+	a, b := 1-t, t
+	norm := math.Hypot(a, b)
+	return func(x, y float64) float64 {
+		return (a*field(x+t*dx, y+t*dy) + b*field(x+(t-1)*dx, y+(t-1)*dy)) / norm
+	}
+}
+
+// cyclePalette moves every color along the closed loop through the palette,
+// by the whole palette over one loop of t
+func cyclePalette(palette []color.RGBA, t float64) []color.RGBA {
+	if t == 0 || len(palette) < 2 {
+		return palette
+	}
+	n := len(palette)
+	cycled := make([]color.RGBA, n)
+	for i := range palette {
+		pos := float64(i) + t*float64(n)
+		idx := int(pos)
+		cycled[i] = interpolateColor(palette[idx%n], palette[(idx+1)%n], pos-float64(idx))
+	}
+	return cycled
+}
+
+// paletteCycling makes a generator without motion of its own evolve by
+// cycling its palette over time
+func paletteCycling(gen BackgroundGenFunc) BackgroundGenFunc {
+	return func(w, h int, params BackgroundParams) *image.RGBA {
+		params.Palette = cyclePalette(params.Palette, params.Time)
+		return gen(w, h, params)
+	}
+}
+
+// checkBackgroundMotion rejects -animate-bg for a -bg value that would stay
+// still: a transparent canvas, or a palette cycling generator whose colors
+// or stops parameter replaces the palette
+func checkBackgroundMotion(background string) error {
+	name, _, _ := splitBackground(background)
+	if name == "none" {
+		return errors.New("-animate-bg needs a generated -bg, -bg=none has nothing to move")
+	}
+	// validateConfig has already checked the background
+	spec, values, _ := parseBackground(background)
+	if spec.Animated {
+		return nil
+	}
+	for _, param := range []string{"colors", "stops"} {
+		if values[param] != "" {
+			return fmt.Errorf("-animate-bg cycles the palette of %s, leave out %s to let it move", name, param)
+		}
+	}
+	return nil
+}
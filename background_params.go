@@ -0,0 +1,209 @@
+// background parameter declarations, parsing and validation
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParamKind tells how a parameter value is parsed
+type ParamKind int
+
+const (
+	paramNumber ParamKind = iota
+	paramInt
+	paramColors // slash separated hex colors, e.g. ff0000/00ff00
+	paramChoice
+	paramStops // gradient stops, e.g. ff0000@0/00ff00@0.3/0000ff
+)
+
+// ParamSpec declares a generator parameter with its default and valid range
+type ParamSpec struct {
+	Name     string
+	Kind     ParamKind
+	Default  string // parsed the same way as user input
+	Min, Max float64
+	Choices  []string
+	Help     string
+}
+
+// BackgroundSpec describes a registered background generator
+type BackgroundSpec struct {
+	Generate    BackgroundGenFunc
+	Description string
+	Params      []ParamSpec
+	// the generator wraps by itself when BackgroundParams.Tileable is set,
+	// others are made tileable by crossfading their edges
+	Tileable bool
+	// the generator moves with BackgroundParams.Time, others cycle their
+	// palette instead
+	Animated bool
+}
+
+// parameters shared by the fractal noise generators
+var noiseParamSpecs = []ParamSpec{
+	{Name: "scale", Default: "150", Min: 1, Max: 5000, Help: "size of the largest features in pixels"},
+	{Name: "octaves", Kind: paramInt, Default: "5", Min: 1, Max: 12, Help: "number of noise layers"},
+	{Name: "lacunarity", Default: "2", Min: 1, Max: 4, Help: "frequency multiplier between octaves"},
+	{Name: "persistence", Default: "0.5", Min: 0.05, Max: 1, Help: "amplitude multiplier between octaves"},
+}
+
+// splitBackground separates "name:key=value,key=value" into its parts
+func splitBackground(value string) (string, map[string]string, error) {
+	name, rest, _ := strings.Cut(value, ":")
+	values := map[string]string{}
+	if rest == "" {
+		return name, values, nil
+	}
+	for _, pair := range strings.Split(rest, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return "", nil, errors.New("invalid background parameter: " + pair)
+		}
+		values[key] = strings.TrimSpace(val)
+	}
+	return name, values, nil
+}
+
+// parseBackground resolves a -bg value into its generator and a complete,
+// validated parameter set with defaults filled in
+func parseBackground(value string) (BackgroundSpec, map[string]string, error) {
+	name, values, err := splitBackground(value)
+	if err != nil {
+		return BackgroundSpec{}, nil, err
+	}
+	spec, exists := backgroundMap[name]
+	if !exists {
+		return BackgroundSpec{}, nil, errors.New("invalid background type: " + name)
+	}
+
+	for key := range values {
+		if !slices.ContainsFunc(spec.Params, func(p ParamSpec) bool { return p.Name == key }) {
+			return BackgroundSpec{}, nil, fmt.Errorf("background %s has no parameter %q", name, key)
+		}
+	}
+
+	resolved := make(map[string]string, len(spec.Params))
+	for _, p := range spec.Params {
+		val, given := values[p.Name]
+		if !given {
+			val = p.Default
+		}
+		if err := p.validate(val); err != nil {
+			return BackgroundSpec{}, nil, fmt.Errorf("background %s: %v", name, err)
+		}
+		resolved[p.Name] = val
+	}
+	return spec, resolved, nil
+}
+
+func (p ParamSpec) validate(val string) error {
+	switch p.Kind {
+	case paramNumber, paramInt:
+		var v float64
+		var err error
+		if p.Kind == paramInt {
+			var i int
+			i, err = strconv.Atoi(val)
+			v = float64(i)
+		} else {
+			v, err = strconv.ParseFloat(val, 64)
+		}
+		if err != nil || math.IsNaN(v) {
+			return fmt.Errorf("%s must be a number, got %q", p.Name, val)
+		}
+		if v < p.Min || v > p.Max {
+			return fmt.Errorf("%s must be between %g and %g", p.Name, p.Min, p.Max)
+		}
+	case paramColors:
+		if _, err := parseColorList(val); err != nil {
+			return fmt.Errorf("%s: %v", p.Name, err)
+		}
+	case paramStops:
+		if _, err := parseGradientStops(val); err != nil {
+			return fmt.Errorf("%s: %v", p.Name, err)
+		}
+	case paramChoice:
+		if !slices.Contains(p.Choices, val) {
+			return fmt.Errorf("%s must be one of %s", p.Name, strings.Join(p.Choices, ", "))
+		}
+	}
+	return nil
+}
+
+// parseColorList parses slash separated hex colors; empty means none
+func parseColorList(val string) ([]color.RGBA, error) {
+	if val == "" {
+		return nil, nil
+	}
+	var colors []color.RGBA
+	for _, hex := range strings.Split(val, "/") {
+		c, err := parseHexColor(hex)
+		if err != nil {
+			return nil, err
+		}
+		colors = append(colors, c)
+	}
+	return colors, nil
+}
+
+// Float returns a numeric parameter. Values are validated up front, so
+// lookups cannot fail during generation
+func (p BackgroundParams) Float(name string) float64 {
+	v, _ := strconv.ParseFloat(p.Values[name], 64)
+	return v
+}
+
+func (p BackgroundParams) Int(name string) int {
+	v, _ := strconv.Atoi(p.Values[name])
+	return v
+}
+
+func (p BackgroundParams) String(name string) string {
+	return p.Values[name]
+}
+
+// Colors returns a color list parameter, or fallback when it is empty
+func (p BackgroundParams) Colors(name string, fallback []color.RGBA) []color.RGBA {
+	colors, _ := parseColorList(p.Values[name])
+	if len(colors) == 0 {
+		return fallback
+	}
+	return colors
+}
+
+// noiseOptions reads the shared fractal noise parameters
+func (p BackgroundParams) noiseOptions() NoiseOptions {
+	return NoiseOptions{
+		Scale:       p.Float("scale"),
+		Octaves:     p.Int("octaves"),
+		Lacunarity:  p.Float("lacunarity"),
+		Persistence: p.Float("persistence"),
+	}
+}
+
+// describeBackgrounds lists every generator with its parameters
+func describeBackgrounds() string {
+	var b strings.Builder
+	for _, name := range getBackgroundTypes() {
+		spec := backgroundMap[name]
+		fmt.Fprintf(&b, "%s - %s\n", name, spec.Description)
+		for _, p := range spec.Params {
+			fmt.Fprintf(&b, "    %-12s %s (default %q", p.Name, p.Help, p.Default)
+			switch p.Kind {
+			case paramNumber, paramInt:
+				fmt.Fprintf(&b, ", range %g to %g", p.Min, p.Max)
+			case paramChoice:
+				fmt.Fprintf(&b, ", one of %s", strings.Join(p.Choices, ", "))
+			}
+			b.WriteString(")\n")
+		}
+	}
+	return b.String()
+}
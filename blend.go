@@ -0,0 +1,99 @@
+// blend modes and layer compositing
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// BlendFunc mixes a backdrop channel with a source channel, both in [0, 1]
+type BlendFunc func(backdrop, source float64) float64
+
+// Blend mode mapping - formulas follow the W3C compositing spec
+var blendModeMap = map[string]BlendFunc{
+	"normal":      blendNormal,
+	"multiply":    blendMultiply,
+	"screen":      blendScreen,
+	"overlay":     blendOverlay,
+	"difference":  blendDifference,
+	"soft-light":  blendSoftLight,
+	"color-dodge": blendColorDodge,
+}
+
+func blendNormal(_, s float64) float64 { return s }
+
+func blendMultiply(b, s float64) float64 { return b * s }
+
+func blendScreen(b, s float64) float64 { return b + s - b*s }
+
+func blendDifference(b, s float64) float64 { return math.Abs(b - s) }
+
+// overlay is hard-light with the layers swapped
+func blendOverlay(b, s float64) float64 {
+	if b <= 0.5 {
+		return blendMultiply(s, 2*b)
+	}
+	return blendScreen(s, 2*b-1)
+}
+
+func blendSoftLight(b, s float64) float64 {
+	if s <= 0.5 {
+		return b - (1-2*s)*b*(1-b)
+	}
+	var d float64
+	if b <= 0.25 {
+		d = ((16*b-12)*b + 4) * b
+	} else {
+		d = math.Sqrt(b)
+	}
+	return b + (2*s-1)*(d-b)
+}
+
+func blendColorDodge(b, s float64) float64 {
+	switch {
+	case b == 0:
+		return 0
+	case s >= 1:
+		return 1
+	default:
+		return math.Min(1, b/(1-s))
+	}
+}
+
+func getBlendModes() []string {
+	return getSortedKeys(blendModeMap)
+}
+
+func getBlendMode(name string) BlendFunc {
+	return getValueOrDefault(name, blendModeMap, blendNormal)
+}
+
+// compositeLayer blends a premultiplied layer onto dst in place. opacity
+// scales the layer's alpha before compositing
+func compositeLayer(dst, layer *image.RGBA, blend BlendFunc, opacity float64) {
+	r := dst.Bounds().Intersect(layer.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		di := dst.PixOffset(r.Min.X, y)
+		li := layer.PixOffset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x, di, li = x+1, di+4, li+4 {
+			la := float64(layer.Pix[li+3]) / 255
+			sa := la * opacity
+			if sa == 0 {
+				continue
+			}
+			ba := float64(dst.Pix[di+3]) / 255
+			for c := range 3 {
+				// unpremultiply to get straight colors for the blend function
+				cs := float64(layer.Pix[li+c]) / 255 / la
+				var cb float64
+				if ba > 0 {
+					cb = float64(dst.Pix[di+c]) / 255 / ba
+				}
+				mixed := (1-ba)*cs + ba*blend(cb, cs)
+				out := sa*mixed + (1-sa)*ba*cb
+				dst.Pix[di+c] = uint8(math.Round(math.Min(1, out) * 255))
+			}
+			dst.Pix[di+3] = uint8(math.Round((sa + ba*(1-sa)) * 255))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Worley (cellular) noise and Voronoi cell backgrounds
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// hashCell mixes lattice coordinates with the seed (splitmix64 finalizer)
+func hashCell(i, j int, seed int64) uint64 {
+	h := uint64(seed) ^ uint64(int64(i))*0x9e3779b97f4a7c15 ^ uint64(int64(j))*0xc2b2ae3d27d4eb4f
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// worleyResult holds the two nearest feature distances and the hash of the
+// nearest cell, all in cell units
+type worleyResult struct {
+	f1, f2 float64
+	cell   uint64
+}
+
+// worley finds the nearest feature points around (x, y). Each lattice cell
+// holds one point displaced from its center by up to jitter/2. Positive
+// periods repeat the lattice every period cells so the pattern wraps
+func worley(x, y, jitter float64, seed int64, periodX, periodY int) worleyResult {
+	ci, cj := int(math.Floor(x)), int(math.Floor(y))
+	res := worleyResult{f1: math.MaxFloat64, f2: math.MaxFloat64}
+
+	for j := cj - 1; j <= cj+1; j++ {
+		for i := ci - 1; i <= ci+1; i++ {
+			h := hashCell(wrapIndex(i, periodX), wrapIndex(j, periodY), seed)
+			px := float64(i) + 0.5 + (float64(h&0xffff)/0xffff-0.5)*jitter
+			py := float64(j) + 0.5 + (float64((h>>16)&0xffff)/0xffff-0.5)*jitter
+			d := math.Hypot(px-x, py-y)
+			if d < res.f1 {
+				res.f1, res.f2, res.cell = d, res.f1, h
+			} else if d < res.f2 {
+				res.f2 = d
+			}
+		}
+	}
+	return res
+}
+
+// cellular noise background. Modes: f1 shades by distance to the nearest
+// point, edge highlights cell borders with F2-F1 and cells flat-shades each
+// Voronoi cell from the palette with dark lead lines
+func generateWorleyBackground(w, h int, params BackgroundParams) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	cellSize := math.Sqrt(float64(w*h) / params.Float("cells"))
+	cellW, cellH := cellSize, cellSize
+	var periodX, periodY int
+	if params.Tileable {
+		// whole cells across the canvas, slightly stretched to fit
+		periodX = max(1, int(math.Round(float64(w)/cellSize)))
+		periodY = max(1, int(math.Round(float64(h)/cellSize)))
+		cellW, cellH = float64(w)/float64(periodX), float64(h)/float64(periodY)
+	}
+	jitter := params.Float("jitter")
+	mode := params.String("mode")
+	// border width in cell units
+	border := params.Float("border") * params.PixelScale / cellSize
+	palette := params.Palette
+	lead := color.RGBA{20, 20, 24, 255}
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		r := worley(float64(x)/cellW, float64(y)/cellH, jitter, params.Seed, periodX, periodY)
+
+		var c color.RGBA
+		switch mode {
+		case "f1":
+			c = samplePalette(palette, r.f1)
+		case "edge":
+			c = samplePalette(palette, math.Min(1, (r.f2-r.f1)*2))
+		default:
+			c = palette[r.cell>>32%uint64(len(palette))]
+			// F2-F1 is about twice the distance to the cell border, so
+			// this draws lines border wide
+			if r.f2-r.f1 < border {
+				c = lead
+			}
+		}
+		return c
+	})
+	return img
+}
@@ -0,0 +1,55 @@
+// color space conversions between sRGB, linear RGB and OKLab
+package main
+
+import (
+	"image/color"
+	"math"
+)
+
+// OKLab is a perceptual color space where euclidean distance roughly matches
+// perceived difference, see https://bottosson.github.io/posts/oklab/
+type OKLab struct {
+	L, A, B float64
+}
+
+// srgbToLinear undoes the sRGB transfer curve for an 8 bit channel
+func srgbToLinear(c uint8) float64 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func rgbaToOKLab(c color.RGBA) OKLab {
+	r, g, b := srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)
+
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	return OKLab{
+		L: 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		A: 1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		B: 0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+func (c OKLab) toRGBA() color.RGBA {
+	l := c.L + 0.3963377774*c.A + 0.2158037573*c.B
+	m := c.L - 0.1055613458*c.A - 0.0638541728*c.B
+	s := c.L - 0.0894841775*c.A - 1.2914855480*c.B
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	return color.RGBA{
+		linearToSRGB8(4.0767416621*l - 3.3077115913*m + 0.2309699292*s),
+		linearToSRGB8(-1.2684380046*l + 2.6097574011*m - 0.3413193965*s),
+		linearToSRGB8(-0.0041960863*l - 0.7034186147*m + 1.7076147010*s),
+		255,
+	}
+}
+
+func (c OKLab) distanceSq(o OKLab) float64 {
+	dl, da, db := c.L-o.L, c.A-o.A, c.B-o.B
+	return dl*dl + da*da + db*db
+}
@@ -6,7 +6,11 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"image/color"
+	"os"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -27,6 +31,70 @@ type Config struct {
 	FontStyle  string
 	RevealBg   bool
 	Animate    bool
+	// render at Supersample times the resolution, then downsample
+	Supersample int
+	// compositing of text layers over the background
+	BlendMode string
+	Opacity   float64
+	// text style and its tunables
+	Style        string
+	Seed         int64
+	NeonColor    string
+	Flicker      bool
+	GlitchShift  int
+	GlitchSlices int
+	Scanlines    int
+	// print the background generators and their parameters
+	ListBackgrounds bool
+	// built-in palette name or palette file path
+	Palette string
+	// reference image to extract PaletteSize dominant colors from
+	PaletteFrom string
+	PaletteSize int
+	// photo background used instead of a generated pattern
+	BackgroundImage  string
+	BackgroundFit    string
+	BackgroundAdjust ImageAdjustments
+	// alpha of the background, 0 leaves only the text
+	BackgroundOpacity float64
+	// wrap the background seamlessly and verify its seams
+	Tileable   bool
+	CheckSeams bool
+	// GIF palette size, how it is built and whether each frame gets its own
+	Colors        int
+	Quantizer     string
+	FramePalettes bool
+	// dithering of paletted output, optionally kept out of the letters
+	Dither    string
+	CrispText bool
+	// named animation effect for GIFs
+	Effect string
+	// JSON keyframe timeline rendered as a GIF instead of an effect
+	Timeline string
+	// animation timing, a zero Duration keeps the effect's natural length,
+	// and the curve of intro effects
+	FPS      float64
+	Duration float64
+	Easing   string
+	// playback: times to play (0 forever), a fixed delay per frame in
+	// milliseconds (0 keeps the animation's timing), seconds to hold the
+	// last frame and whether to play back and forth
+	Loop       int
+	FrameDelay int
+	Hold       float64
+	PingPong   bool
+	// evolve generated backgrounds across the frames of an animation
+	AnimateBackground bool
+	// store only the changed part of each animation frame
+	OptimizeFrames bool
+	// file format of animations
+	Format string
+
+	// filled in by validateConfig so rendering doesn't load them again: the
+	// background palette, extracted with k-means for -palette-from, and the
+	// -timeline animation
+	palette  []color.RGBA
+	timeline *Timeline
 }
 
 // Font mapping - maps user-friendly names to font files
@@ -61,22 +129,210 @@ var fontMap = map[string]string{
 }
 
 // Backgroung generator mapping
-var backgroundMap = map[string]BackgroundGenFunc{
-	"default":  generatePatternBackground,
-	"perlin":   generatePerlinLikeBackground,
-	"perlin-s": generatePerlinSmootherBackground,
-	"radial":   generateRadialPatternBackground,
-	"diagonal": generateDiagonalGridBackground,
+var backgroundMap = map[string]BackgroundSpec{
+	"default": {
+		Generate:    generatePatternBackground,
+		Description: "XOR pattern",
+		Animated:    true,
+	},
+	"none": {
+		Generate:    generateTransparentBackground,
+		Description: "fully transparent, for text overlays",
+		Tileable:    true,
+	},
+	"perlin": {
+		Generate:    generatePerlinLikeBackground,
+		Description: "sum of sine waves",
+		Params: []ParamSpec{
+			{Name: "scale", Default: "1", Min: 0.1, Max: 10, Help: "wavelength multiplier"},
+		},
+	},
+	"perlin-s": {
+		Generate:    generatePerlinSmootherBackground,
+		Description: "smooth multi-octave sine waves",
+		Params: []ParamSpec{
+			{Name: "octaves", Kind: paramInt, Default: "6", Min: 1, Max: 12, Help: "number of wave layers"},
+			{Name: "lacunarity", Default: "1.8", Min: 1, Max: 4, Help: "frequency multiplier between layers"},
+			{Name: "persistence", Default: "0.6", Min: 0.05, Max: 1, Help: "amplitude multiplier between layers"},
+		},
+	},
+	"perlin-fbm": {
+		Generate:    generatePerlinBackground,
+		Description: "fractal Perlin noise",
+		Params:      noiseParamSpecs,
+		Tileable:    true,
+		Animated:    true,
+	},
+	"perlin-warp": {
+		Generate:    generatePerlinWarpedBackground,
+		Description: "domain warped Perlin noise with soft, flowing shapes",
+		Params: append(slices.Clone(noiseParamSpecs),
+			ParamSpec{Name: "warp", Default: "1.5", Min: 0, Max: 5, Help: "strength of the domain warp"}),
+		Tileable: true,
+		Animated: true,
+	},
+	"simplex": {
+		Generate:    generateSimplexBackground,
+		Description: "fractal OpenSimplex2 noise",
+		Params:      noiseParamSpecs,
+		Tileable:    true,
+		Animated:    true,
+	},
+	"radial": {
+		Generate:    generateRadialPatternBackground,
+		Description: "colorful rings and spokes",
+		Params: []ParamSpec{
+			{Name: "spacing", Default: "1", Min: 0.1, Max: 20, Help: "ring spacing multiplier"},
+			{Name: "spokes", Kind: paramInt, Default: "1", Min: 1, Max: 20, Help: "angular frequency multiplier"},
+			{Name: "cx", Default: "0.5", Min: 0, Max: 1, Help: "center x as a fraction of the width"},
+			{Name: "cy", Default: "0.5", Min: 0, Max: 1, Help: "center y as a fraction of the height"},
+		},
+		Animated: true,
+	},
+	"diagonal": {
+		Generate:    generateDiagonalGridBackground,
+		Description: "shaded stripes",
+		Params: []ParamSpec{
+			{Name: "grid", Default: "50", Min: 2, Max: 1000, Help: "stripe period in pixels"},
+			{Name: "angle", Default: "45", Min: -180, Max: 180, Help: "stripe angle in degrees"},
+			{Name: "shade", Default: "0.7", Min: 0, Max: 1, Help: "brightness of the darker half"},
+			{Name: "colors", Kind: paramColors, Help: "stripe colors such as ff0000/00ff00, empty uses the palette"},
+		},
+		Tileable: true,
+		Animated: true,
+	},
+	"worley": {
+		Generate:    generateWorleyBackground,
+		Description: "cellular noise and flat-shaded Voronoi cells",
+		Params: []ParamSpec{
+			{Name: "cells", Default: "24", Min: 2, Max: 5000, Help: "approximate number of cells"},
+			{Name: "jitter", Default: "1", Min: 0, Max: 1, Help: "how far points stray from a regular grid"},
+			{Name: "mode", Kind: paramChoice, Default: "cells", Choices: []string{"f1", "edge", "cells"}, Help: "distance shading, cell edges or flat cells"},
+			{Name: "border", Default: "3", Min: 0, Max: 50, Help: "lead line width between flat cells in pixels"},
+		},
+		Tileable: true,
+	},
+	"lowpoly": {
+		Generate:    generateLowPolyBackground,
+		Description: "Delaunay triangles shaded along a palette gradient",
+		Params: []ParamSpec{
+			{Name: "points", Default: "80", Min: 4, Max: 5000, Help: "approximate number of lattice points"},
+			{Name: "jitter", Default: "0.8", Min: 0, Max: 1, Help: "how far points stray from the lattice"},
+			{Name: "angle", Default: "45", Min: -180, Max: 180, Help: "gradient direction in degrees"},
+			{Name: "variance", Default: "0.08", Min: 0, Max: 0.5, Help: "random brightness change per triangle"},
+		},
+	},
+	"hexagon": {
+		Generate:    generateHexagonBackground,
+		Description: "hexagon tiling colored from the palette",
+		Params: []ParamSpec{
+			{Name: "size", Default: "30", Min: 3, Max: 1000, Help: "hexagon radius in pixels"},
+			{Name: "border", Default: "2", Min: 0, Max: 50, Help: "border width in pixels"},
+		},
+		Tileable: true,
+	},
+	"circles": {
+		Generate:    generateCirclesBackground,
+		Description: "concentric rings",
+		Params: []ParamSpec{
+			{Name: "spacing", Default: "20", Min: 1, Max: 1000, Help: "ring width in pixels"},
+			{Name: "cx", Default: "0.5", Min: 0, Max: 1, Help: "center x as a fraction of the width"},
+			{Name: "cy", Default: "0.5", Min: 0, Max: 1, Help: "center y as a fraction of the height"},
+		},
+	},
+	"chevron": {
+		Generate:    generateChevronBackground,
+		Description: "zigzag bands",
+		Params: []ParamSpec{
+			{Name: "band", Default: "25", Min: 1, Max: 1000, Help: "band thickness in pixels"},
+			{Name: "width", Default: "80", Min: 2, Max: 2000, Help: "horizontal period of the zigzag in pixels"},
+			{Name: "height", Default: "40", Min: 0, Max: 2000, Help: "zigzag amplitude in pixels"},
+		},
+		Tileable: true,
+	},
+	"dots": {
+		Generate:    generateDotsBackground,
+		Description: "polka dots on the first palette color",
+		Params: []ParamSpec{
+			{Name: "spacing", Default: "40", Min: 2, Max: 1000, Help: "distance between dot centers in pixels"},
+			{Name: "radius", Default: "0.5", Min: 0.05, Max: 1, Help: "dot diameter as a fraction of the spacing"},
+			{Name: "layout", Kind: paramChoice, Default: "staggered", Choices: []string{"grid", "staggered"}, Help: "dot arrangement"},
+		},
+		Tileable: true,
+	},
+	"stripes": {
+		Generate:    generateStripesBackground,
+		Description: "flat stripes at any angle",
+		Params: []ParamSpec{
+			{Name: "width", Default: "30", Min: 1, Max: 1000, Help: "stripe width in pixels"},
+			{Name: "angle", Default: "0", Min: -180, Max: 180, Help: "stripe angle in degrees, 0 gives vertical stripes"},
+			{Name: "colors", Kind: paramColors, Help: "stripe colors such as ff0000/00ff00, empty uses the palette"},
+		},
+		Tileable: true,
+	},
+	"mandelbrot": {
+		Generate:    generateMandelbrotBackground,
+		Description: "Mandelbrot set with smooth iteration coloring",
+		Params: append(slices.Clone(escapeParamSpecs),
+			ParamSpec{Name: "cx", Default: "-0.6", Min: -3, Max: 3, Help: "real part of the view center"},
+			ParamSpec{Name: "cy", Default: "0", Min: -3, Max: 3, Help: "imaginary part of the view center"}),
+	},
+	"julia": {
+		Generate:    generateJuliaBackground,
+		Description: "Julia set with smooth iteration coloring",
+		Params: append(slices.Clone(escapeParamSpecs),
+			ParamSpec{Name: "cx", Default: "0", Min: -3, Max: 3, Help: "real part of the view center"},
+			ParamSpec{Name: "cy", Default: "0", Min: -3, Max: 3, Help: "imaginary part of the view center"},
+			ParamSpec{Name: "cr", Default: "-0.8", Min: -2, Max: 2, Help: "real part of the Julia constant"},
+			ParamSpec{Name: "ci", Default: "0.156", Min: -2, Max: 2, Help: "imaginary part of the Julia constant"}),
+	},
+	"flame": {
+		Generate:    generateFlameBackground,
+		Description: "IFS flame attractor, shaped by the seed",
+		Params: []ParamSpec{
+			{Name: "transforms", Kind: paramInt, Default: "3", Min: 2, Max: 12, Help: "number of affine maps"},
+			{Name: "density", Default: "20", Min: 1, Max: 500, Help: "samples per pixel"},
+			{Name: "gamma", Default: "2.2", Min: 0.2, Max: 8, Help: "brightness curve of the density"},
+		},
+	},
+	"linear-gradient": {
+		Generate:    generateLinearGradientBackground,
+		Description: "linear gradient with any number of color stops",
+		Params: append(slices.Clone(gradientParamSpecs),
+			ParamSpec{Name: "angle", Default: "90", Min: -360, Max: 360, Help: "direction in degrees, 0 is left to right and 90 top to bottom"}),
+	},
+	"radial-gradient": {
+		Generate:    generateRadialGradientBackground,
+		Description: "circular gradient spreading from a center",
+		Params: append(slices.Clone(gradientParamSpecs),
+			ParamSpec{Name: "cx", Default: "0.5", Min: 0, Max: 1, Help: "center x as a fraction of the width"},
+			ParamSpec{Name: "cy", Default: "0.5", Min: 0, Max: 1, Help: "center y as a fraction of the height"},
+			ParamSpec{Name: "radius", Default: "1", Min: 0.01, Max: 10, Help: "radius as a fraction of the distance to the farthest corner"}),
+	},
+	"conic-gradient": {
+		Generate:    generateConicGradientBackground,
+		Description: "gradient sweeping around a center",
+		Params: append(slices.Clone(gradientParamSpecs),
+			ParamSpec{Name: "cx", Default: "0.5", Min: 0, Max: 1, Help: "center x as a fraction of the width"},
+			ParamSpec{Name: "cy", Default: "0.5", Min: 0, Max: 1, Help: "center y as a fraction of the height"},
+			ParamSpec{Name: "angle", Default: "0", Min: -360, Max: 360, Help: "start angle in degrees"}),
+	},
 }
 
 const (
-	backgroundDPI  = 72
-	gifFrameDelay  = 15
-	gifNumCylces   = 2
-	maxPaletteSize = 256
+	backgroundDPI = 72
+	gifFrameDelay = 15
+	// GIFs store the loop count in 16 bits
+	maxLoopCount = 65535
+	// and frame delays in hundredths of a second in 16 bits
+	maxFrameDelay = 65535
+	// frames generated for styles that animate themselves
+	styledFrameCount = 12
+	maxPaletteSize   = 256
+	maxSupersample   = 8
 )
 
-func validateConfig(config Config) error {
+func validateConfig(config *Config) error {
 	if config.Width <= 0 || config.Height <= 0 {
 		return errors.New("width and height must be positive")
 	}
@@ -86,8 +342,110 @@ func validateConfig(config Config) error {
 	if _, exists := fontMap[config.FontStyle]; !exists {
 		return errors.New("invalid font style: " + config.FontStyle)
 	}
-	if _, exists := backgroundMap[config.Background]; !exists {
-		return errors.New("invalid background type: " + config.Background)
+	if _, _, err := parseBackground(config.Background); err != nil {
+		return err
+	}
+	if config.Supersample < 1 || config.Supersample > maxSupersample {
+		return fmt.Errorf("supersample must be between 1 and %d", maxSupersample)
+	}
+	// the GIF palette also holds black and white
+	if config.PaletteSize < minPaletteColors || config.PaletteSize > maxPaletteSize-2 {
+		return fmt.Errorf("palette size must be between %d and %d", minPaletteColors, maxPaletteSize-2)
+	}
+	palette, err := resolvePalette(*config)
+	if err != nil {
+		return err
+	}
+	config.palette = palette
+	if config.Colors < 2 || config.Colors > maxPaletteSize {
+		return fmt.Errorf("colors must be between 2 and %d", maxPaletteSize)
+	}
+	if _, exists := quantizerMap[config.Quantizer]; !exists {
+		return errors.New("invalid quantizer: " + config.Quantizer)
+	}
+	if _, exists := effectMap[config.Effect]; !exists {
+		return errors.New("invalid effect: " + config.Effect)
+	}
+	if config.Effect != "classic" && config.RevealBg {
+		return errors.New("-reveal-bg only works with the classic effect")
+	}
+	if config.FPS <= 0 || config.FPS > maxFPS {
+		return fmt.Errorf("fps must be between 0 and %d", maxFPS)
+	}
+	if config.Duration < 0 {
+		return errors.New("duration can't be negative")
+	}
+	if n := frameCount(config.Duration, config.FPS); config.Duration > 0 && n > maxAnimationFrames {
+		return fmt.Errorf("duration at this fps takes %d frames, at most %d", n, maxAnimationFrames)
+	}
+	if _, err := parseEasing(config.Easing); err != nil {
+		return err
+	}
+	if config.Loop < 0 || config.Loop > maxLoopCount {
+		return fmt.Errorf("loop must be between 0 and %d", maxLoopCount)
+	}
+	if config.FrameDelay < 0 || config.Hold < 0 {
+		return errors.New("frame delay and hold can't be negative")
+	}
+	if config.FrameDelay > maxFrameDelay*10 || config.Hold*100 > maxFrameDelay {
+		return fmt.Errorf("frame delay can be at most %d milliseconds and hold at most %g seconds", maxFrameDelay*10, maxFrameDelay/100.0)
+	}
+	if config.FrameDelay > 0 && config.Duration > 0 {
+		return errors.New("-frame-delay can't be combined with -duration")
+	}
+	if config.Timeline != "" {
+		if config.Effect != "classic" || config.RevealBg {
+			return errors.New("-timeline can't be combined with -effect or -reveal-bg")
+		}
+		timeline, err := loadTimeline(config.Timeline, *config)
+		if err != nil {
+			return err
+		}
+		config.timeline = timeline
+	}
+	if _, exists := animationFormatMap[config.Format]; !exists {
+		return errors.New("invalid format: " + config.Format)
+	}
+	if _, exists := ditherMap[config.Dither]; !exists {
+		return errors.New("invalid dither: " + config.Dither)
+	}
+	if config.BackgroundImage != "" {
+		if _, err := os.Stat(config.BackgroundImage); err != nil {
+			return errors.New("background image not found: " + config.BackgroundImage)
+		}
+		if config.AnimateBackground {
+			return errors.New("-animate-bg needs a generated -bg, not -bg-image")
+		}
+	}
+	if config.AnimateBackground && config.BackgroundImage == "" {
+		if err := checkBackgroundMotion(config.Background); err != nil {
+			return err
+		}
+	}
+	if _, exists := imageFitMap[config.BackgroundFit]; !exists {
+		return errors.New("invalid background fit: " + config.BackgroundFit)
+	}
+	adjust := config.BackgroundAdjust
+	if adjust.Blur < 0 || adjust.Darken < 0 || adjust.Darken > 1 || adjust.Desaturate < 0 || adjust.Desaturate > 1 {
+		return errors.New("background blur must not be negative, darken and desaturate must be between 0 and 1")
+	}
+	if config.BackgroundOpacity < 0 || config.BackgroundOpacity > 1 {
+		return errors.New("background opacity must be between 0 and 1")
+	}
+	if _, exists := blendModeMap[config.BlendMode]; !exists {
+		return errors.New("invalid blend mode: " + config.BlendMode)
+	}
+	if config.Opacity < 0 || config.Opacity > 1 {
+		return errors.New("opacity must be between 0 and 1")
+	}
+	if _, exists := textStyleMap[config.Style]; !exists {
+		return errors.New("invalid text style: " + config.Style)
+	}
+	if _, err := parseHexColor(config.NeonColor); err != nil {
+		return err
+	}
+	if config.GlitchShift < 0 || config.GlitchSlices < 0 || config.Scanlines < 0 {
+		return errors.New("glitch settings must not be negative")
 	}
 
 	return nil
@@ -125,8 +483,21 @@ func getFontPath(fontStyle string) string {
 	return getValueOrDefault(fontStyle, fontMap, fontMap["roboto_bold"])
 }
 
-func getBackgroundGenerator(bgType string) BackgroundGenFunc {
-	return getValueOrDefault(bgType, backgroundMap, backgroundMap["default"])
+// parseHexColor parses "#rrggbb", "rrggbb" or the short "#rgb" form
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	var c color.RGBA
+	if len(hex) != 6 {
+		return c, errors.New("invalid hex color: " + s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return c, errors.New("invalid hex color: " + s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
 }
 
 func sanitizeFilename(text string) string {
@@ -0,0 +1,94 @@
+// dithering for paletted output
+package main
+
+import "math"
+
+// ditherWeight hands part of a pixel's quantization error to the neighbour
+// dx, dy away
+type ditherWeight struct {
+	dx, dy int
+	weight float64
+}
+
+// DitherSpec is either an error diffusion kernel or the size of an ordered
+// Bayer matrix, neither means no dithering
+type DitherSpec struct {
+	Kernel      []ditherWeight
+	Bayer       int
+	Description string
+}
+
+// Dither mapping
+var ditherMap = map[string]DitherSpec{
+	"none": {
+		Description: "nearest palette color",
+	},
+	"floyd-steinberg": {
+		Kernel: []ditherWeight{
+			{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+		},
+		Description: "error diffusion to the four following neighbours",
+	},
+	"atkinson": {
+		// passes on only three quarters of the error, for more contrast
+		Kernel: []ditherWeight{
+			{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8},
+			{-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8},
+			{0, 2, 1.0 / 8},
+		},
+		Description: "partial error diffusion with crisper contrast",
+	},
+	"sierra": {
+		Kernel: []ditherWeight{
+			{1, 0, 5.0 / 32}, {2, 0, 3.0 / 32},
+			{-2, 1, 2.0 / 32}, {-1, 1, 4.0 / 32}, {0, 1, 5.0 / 32}, {1, 1, 4.0 / 32}, {2, 1, 2.0 / 32},
+			{-1, 2, 2.0 / 32}, {0, 2, 3.0 / 32}, {1, 2, 2.0 / 32},
+		},
+		Description: "error diffusion over three rows, smoother than floyd-steinberg",
+	},
+	"bayer2": {Bayer: 2, Description: "ordered 2x2 threshold pattern"},
+	"bayer4": {Bayer: 4, Description: "ordered 4x4 threshold pattern"},
+	"bayer8": {Bayer: 8, Description: "ordered 8x8 threshold pattern"},
+}
+
+func getDitherNames() []string {
+	return getSortedKeys(ditherMap)
+}
+
+// bayerMatrix returns the n by n threshold map for n a power of two, with
+// thresholds centered on zero in (-0.5, 0.5)
+func bayerMatrix(n int) [][]float64 {
+	index := [][]int{{0}}
+	for size := 1; size < n; size *= 2 {
+		next := make([][]int, size*2)
+		for y := range next {
+			next[y] = make([]int, size*2)
+		}
+		// each quadrant repeats the smaller matrix, interleaved as 0 2 / 3 1
+		for y := range size {
+			for x := range size {
+				v := 4 * index[y][x]
+				next[y][x] = v
+				next[y][x+size] = v + 2
+				next[y+size][x] = v + 3
+				next[y+size][x+size] = v + 1
+			}
+		}
+		index = next
+	}
+
+	matrix := make([][]float64, n)
+	for y := range n {
+		matrix[y] = make([]float64, n)
+		for x := range n {
+			matrix[y][x] = (float64(index[y][x])+0.5)/float64(n*n) - 0.5
+		}
+	}
+	return matrix
+}
+
+// ditherSpread is how far ordered dithering pushes a channel, about the gap
+// between neighbouring colors of a palette with this many entries
+func ditherSpread(colors int) float64 {
+	return 255 / math.Max(1, math.Cbrt(float64(colors))-1)
+}
@@ -0,0 +1,175 @@
+// easing curves and frame timing for animations
+package main
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// GIF delays are whole hundredths of a second and browsers slow down
+	// anything shorter than two, which caps the frame rate
+	maxFPS = 50
+	// longest animation, in frames
+	maxAnimationFrames = 1000
+	// steps of the "steps" easing without an explicit count
+	defaultEasingSteps = 5
+)
+
+// EasingFunc maps linear progress t in [0, 1] to eased progress, starting
+// at 0 and ending at 1. Some curves overshoot on the way
+type EasingFunc func(t float64) float64
+
+// Easing mapping, "steps" also takes a count as steps:N
+var easingMap = map[string]EasingFunc{
+	"linear":      func(t float64) float64 { return t },
+	"ease-in":     easeInCubic,
+	"ease-out":    easeOutCubic,
+	"ease-in-out": easeInOutCubic,
+	"elastic":     easeOutElastic,
+	"bounce":      easeOutBounce,
+	"back":        easeOutBack,
+	"steps":       easeSteps(defaultEasingSteps),
+}
+
+func getEasingNames() []string {
+	return getSortedKeys(easingMap)
+}
+
+// parseEasing resolves an easing name, an empty name is linear
+func parseEasing(name string) (EasingFunc, error) {
+	if name == "" {
+		return easingMap["linear"], nil
+	}
+	if count, ok := strings.CutPrefix(name, "steps:"); ok {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 || n > maxAnimationFrames {
+			return nil, errors.New("invalid step count in easing: " + name)
+		}
+		return easeSteps(n), nil
+	}
+	ease, exists := easingMap[name]
+	if !exists {
+		return nil, errors.New("invalid easing " + strconv.Quote(name) + ", use one of " + strings.Join(getEasingNames(), ", ") + " or steps:N")
+	}
+	return ease, nil
+}
+
+// easeInCubic starts slowly and speeds up
+func easeInCubic(t float64) float64 {
+	return t * t * t
+}
+
+// easeOutCubic starts fast and settles gently into place
+func easeOutCubic(t float64) float64 {
+	return 1 - math.Pow(1-t, 3)
+}
+
+// easeInOutCubic speeds up through the first half and slows down through
+// the second
+func easeInOutCubic(t float64) float64 {
+	if t < 0.5 {
+		return 4 * t * t * t
+	}
+	return 1 - math.Pow(-2*t+2, 3)/2
+}
+
+// easeOutElastic shoots past the end and wobbles into place like a spring
+func easeOutElastic(t float64) float64 {
+	if t <= 0 || t >= 1 {
+		return t
+	}
+	return math.Pow(2, -10*t)*math.Sin((10*t-0.75)*2*math.Pi/3) + 1
+}
+
+// easeOutBounce drops onto the end and bounces a few times, each lower
+func easeOutBounce(t float64) float64 {
+	const n, d = 7.5625, 2.75
+	switch {
+	case t < 1/d:
+		return n * t * t
+	case t < 2/d:
+		t -= 1.5 / d
+		return n*t*t + 0.75
+	case t < 2.5/d:
+		t -= 2.25 / d
+		return n*t*t + 0.9375
+	}
+	t -= 2.625 / d
+	return n*t*t + 0.984375
+}
+
+// easeOutBack overshoots the end slightly before settling back
+func easeOutBack(t float64) float64 {
+	const c1 = 1.70158
+	const c3 = c1 + 1
+	return 1 + c3*math.Pow(t-1, 3) + c1*math.Pow(t-1, 2)
+}
+
+// easeSteps jumps between n evenly spaced levels instead of moving smoothly
+func easeSteps(n int) EasingFunc {
+	return func(t float64) float64 {
+		if t >= 1 {
+			return 1
+		}
+		return math.Floor(t*float64(n)) / float64(n)
+	}
+}
+
+// frameCount is the number of frames for duration seconds at fps
+func frameCount(duration, fps float64) int {
+	return max(1, int(math.Round(duration*fps)))
+}
+
+// playbackOrder returns the frames in the order they play along with the
+// delay of each, at most maxFrameDelay, with -frame-delay, -hold and
+// -pingpong applied. The frames themselves are stored once, repeats point
+// back at them
+func playbackOrder(delays []int, config Config) ([]int, []int) {
+	delays = slices.Clone(delays)
+	if config.FrameDelay > 0 {
+		for i := range delays {
+			delays[i] = max(1, int(math.Round(float64(config.FrameDelay)/10)))
+		}
+	}
+	last := len(delays) - 1
+	delays[last] += int(math.Round(config.Hold * 100))
+	// a held frame or a very slow animation mustn't wrap around the 16 bit
+	// GIF delay
+	for i := range delays {
+		delays[i] = min(delays[i], maxFrameDelay)
+	}
+
+	order := make([]int, len(delays))
+	for i := range order {
+		order[i] = i
+	}
+	if config.PingPong {
+		// back down without repeating either end, which the loop shows
+		for i := last - 1; i > 0; i-- {
+			order = append(order, i)
+		}
+	}
+	ordered := make([]int, len(order))
+	for i, frame := range order {
+		ordered[i] = delays[frame]
+	}
+	return order, ordered
+}
+
+// frameDelays spreads duration seconds over n frames in the hundredths of
+// a second GIFs count in. Rounding the running total keeps the sum exact,
+// so 30 fps alternates between 3 and 4
+func frameDelays(n int, duration float64) []int {
+	total := duration * 100
+	delays := make([]int, n)
+	for i := range n {
+		start := math.Round(float64(i) * total / float64(n))
+		end := math.Round(float64(i+1) * total / float64(n))
+		delays[i] = max(1, int(end-start))
+	}
+	return delays
+}
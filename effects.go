@@ -0,0 +1,390 @@
+// animation effects for GIFs
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/font"
+)
+
+// natural effect timing in seconds, -duration stretches it
+const (
+	// one cycle of an effect that loops
+	loopDuration = 1.6
+	// an intro effect brings the text in over the first introShare of its
+	// duration and holds it in place for the rest
+	introDuration = 2
+	introShare    = 0.6
+	// between typed letters, and how long the typed text is held
+	typeInterval = 0.1
+	typeHold     = 1
+	// the cursor stays on and then off this long
+	cursorBlink = 0.4
+)
+
+// textLayout is the wrapped text and its resting place on the canvas, the
+// starting point of every effect
+type textLayout struct {
+	renderer   *TextRenderer
+	style      TextStyleFunc
+	lines      []string
+	origins    []image.Point
+	lineHeight int
+	fontStyle  string
+	fontSize   float64
+	width      int
+	height     int
+}
+
+// effectTime is where a frame falls within an effect
+type effectTime struct {
+	// frame index, seeds the styles and random motion
+	frame int
+	// seconds since the start and length of the whole effect
+	t, duration float64
+	// curve of the intro effects
+	ease EasingFunc
+}
+
+// intro is the eased progress of an intro effect, reaching 1 after
+// introShare of the duration and staying there
+func (at effectTime) intro() float64 {
+	return at.ease(math.Min(1, at.t/(at.duration*introShare)))
+}
+
+// cycle is the progress through a looping effect, in [0, 1)
+func (at effectTime) cycle() float64 {
+	return at.t / at.duration
+}
+
+// EffectFunc draws the text at the given time onto img
+type EffectFunc func(l textLayout, img *image.RGBA, at effectTime) error
+
+// EffectSpec describes an animation effect, Duration is its natural length
+// in seconds for the layout
+type EffectSpec struct {
+	Render      EffectFunc
+	Duration    func(l textLayout) float64
+	Description string
+}
+
+// Effect mapping, "classic" is handled by generateAnimatedGIF itself
+var effectMap = map[string]EffectSpec{
+	"classic": {
+		Description: "outline, reveal, plain and reveal-outline frames, or the style's own animation",
+	},
+	"typewriter": {
+		Render:      renderTypewriter,
+		Duration:    typewriterDuration,
+		Description: "types the text letter by letter behind a cursor",
+	},
+	"fade-in": {
+		Render:      renderFadeIn,
+		Duration:    introLength,
+		Description: "fades the text in",
+	},
+	"slide-left": {
+		Render:      slideFrom(-1, 0),
+		Duration:    introLength,
+		Description: "slides the text in from the left edge",
+	},
+	"slide-right": {
+		Render:      slideFrom(1, 0),
+		Duration:    introLength,
+		Description: "slides the text in from the right edge",
+	},
+	"slide-top": {
+		Render:      slideFrom(0, -1),
+		Duration:    introLength,
+		Description: "slides the text in from the top edge",
+	},
+	"slide-bottom": {
+		Render:      slideFrom(0, 1),
+		Duration:    introLength,
+		Description: "slides the text in from the bottom edge",
+	},
+	"zoom": {
+		Render:      renderZoom,
+		Duration:    introLength,
+		Description: "grows the text from the center",
+	},
+	"bounce": {
+		Render:      renderBounce,
+		Duration:    loopLength,
+		Description: "bounces the letters one after another",
+	},
+	"wave": {
+		Render:      renderWave,
+		Duration:    loopLength,
+		Description: "runs a wave through the letters",
+	},
+	"rainbow": {
+		Render:      renderRainbow,
+		Duration:    loopLength,
+		Description: "cycles the letters through the hues, ignores -style",
+	},
+	"shake": {
+		Render:      renderShake,
+		Duration:    func(textLayout) float64 { return loopDuration / 2 },
+		Description: "shakes the text at random",
+	},
+	"cursor": {
+		Render:      renderCursor,
+		Duration:    func(textLayout) float64 { return 2 * cursorBlink },
+		Description: "shows the text with a blinking cursor",
+	},
+}
+
+func getEffectNames() []string {
+	return getSortedKeys(effectMap)
+}
+
+// renderEffect draws the frames of an effect lasting duration seconds at
+// fps over the background of each frame, along with masks of the letters
+// when withMasks is set
+func renderEffect(effect EffectSpec, l textLayout, background func(frame int) *image.RGBA, duration, fps float64, ease EasingFunc, withMasks bool) ([]*image.RGBA, []*image.RGBA, error) {
+	var frames, masks []*image.RGBA
+	for i := range frameCount(duration, fps) {
+		at := effectTime{frame: i, t: float64(i) / fps, duration: duration, ease: ease}
+		img := background(i)
+		if err := effect.Render(l, img, at); err != nil {
+			return nil, nil, err
+		}
+		frames = append(frames, img)
+		if withMasks {
+			// the letters move, so every frame gets its own mask
+			mask := image.NewRGBA(img.Rect)
+			if err := effect.Render(l, mask, at); err != nil {
+				return nil, nil, err
+			}
+			masks = append(masks, mask)
+		}
+	}
+	return frames, masks, nil
+}
+
+func introLength(textLayout) float64 { return introDuration }
+
+func loopLength(textLayout) float64 { return loopDuration }
+
+// typewriterDuration types every letter and the cursor position before
+// holding the text
+func typewriterDuration(l textLayout) float64 {
+	return float64(l.runeCount()+1)*typeInterval + typeHold
+}
+
+// draw renders lines at origins in the configured style
+func (l textLayout) draw(tr *TextRenderer, img *image.RGBA, lines []string, origins []image.Point, frame int) {
+	l.style(tr, img, lines, origins, frame)
+}
+
+// shifted returns the origins moved by dx, dy
+func (l textLayout) shifted(dx, dy int) []image.Point {
+	origins := make([]image.Point, len(l.origins))
+	for i, o := range l.origins {
+		origins[i] = o.Add(image.Pt(dx, dy))
+	}
+	return origins
+}
+
+func (l textLayout) runeCount() int {
+	n := 0
+	for _, line := range l.lines {
+		n += len([]rune(line))
+	}
+	return n
+}
+
+// advance is the width renderText moves across for text
+func (l textLayout) advance(text string) int {
+	width := 0
+	for _, r := range text {
+		if l.renderer.isEmoji(r) {
+			continue
+		}
+		_, adv := font.BoundString(l.renderer.face, string(r))
+		width += adv.Ceil()
+	}
+	return width
+}
+
+// letters splits the lines into single letters at the positions renderText
+// gives them, so effects can move each one on its own
+func (l textLayout) letters() ([]string, []image.Point) {
+	var letters []string
+	var origins []image.Point
+	for i, line := range l.lines {
+		x := l.origins[i].X
+		for _, r := range line {
+			if l.renderer.isEmoji(r) {
+				continue
+			}
+			if r != ' ' {
+				letters = append(letters, string(r))
+				origins = append(origins, image.Pt(x, l.origins[i].Y))
+			}
+			x += l.advance(string(r))
+		}
+	}
+	return letters, origins
+}
+
+// cursorAt draws a text cursor just after the dot position x, y
+func (l textLayout) cursorAt(img *image.RGBA, x, y, frame int) {
+	gap := l.lineHeight / 20
+	l.draw(l.renderer, img, []string{"|"}, []image.Point{{x + gap, y}}, frame)
+}
+
+func renderTypewriter(l textLayout, img *image.RGBA, at effectTime) error {
+	// -duration stretches the typing and the hold alike
+	interval := typeInterval * at.duration / typewriterDuration(l)
+	typed := min(int(at.t/interval), l.runeCount())
+	lines := make([]string, 0, len(l.lines))
+	left := typed
+	for _, line := range l.lines {
+		runes := []rune(line)
+		n := min(left, len(runes))
+		lines = append(lines, string(runes[:n]))
+		left -= n
+		if left == 0 {
+			break
+		}
+	}
+	l.draw(l.renderer, img, lines, l.origins[:len(lines)], at.frame)
+
+	// the cursor follows the typing, then blinks once the text is complete
+	done := at.t - float64(l.runeCount())*interval
+	if done < 0 || int(done/cursorBlink)%2 == 0 {
+		last := max(len(lines)-1, 0)
+		x := l.origins[last].X
+		if len(lines) > 0 {
+			x += l.advance(lines[last])
+		}
+		l.cursorAt(img, x, l.origins[last].Y, at.frame)
+	}
+	return nil
+}
+
+func renderFadeIn(l textLayout, img *image.RGBA, at effectTime) error {
+	tr := *l.renderer
+	// overshooting curves would push the opacity past full
+	tr.opacity *= math.Max(0, math.Min(1, at.intro()))
+	l.draw(&tr, img, l.lines, l.origins, at.frame)
+	return nil
+}
+
+// slideFrom moves the text in from one canvas length away along dx, dy
+func slideFrom(dx, dy int) EffectFunc {
+	return func(l textLayout, img *image.RGBA, at effectTime) error {
+		remaining := 1 - at.intro()
+		offsetX := int(math.Round(remaining * float64(dx*l.width)))
+		offsetY := int(math.Round(remaining * float64(dy*l.height)))
+		l.draw(l.renderer, img, l.lines, l.shifted(offsetX, offsetY), at.frame)
+		return nil
+	}
+}
+
+// scaled returns the layout with the font scaled around the canvas center,
+// along with a function that releases the scaled font
+func (l textLayout) scaled(scale float64) (textLayout, func(), error) {
+	if scale == 1 {
+		return l, func() {}, nil
+	}
+	face, err := loadFontFace(l.fontStyle, l.fontSize*scale)
+	if err != nil {
+		return l, nil, err
+	}
+
+	tr := *l.renderer
+	tr.face = face
+	centerY := float64(l.height) / 2
+	startY := int(math.Round(centerY + (float64(l.origins[0].Y)-centerY)*scale))
+	l.renderer = &tr
+	l.fontSize *= scale
+	l.lineHeight = int(math.Round(float64(l.lineHeight) * scale))
+	l.origins = tr.lineOrigins(l.lines, l.width, startY, l.lineHeight)
+	return l, func() { face.Close() }, nil
+}
+
+// renderZoom redraws the text with a font scaled around the canvas center
+func renderZoom(l textLayout, img *image.RGBA, at effectTime) error {
+	scale := at.intro()
+	if scale*l.fontSize < 1 {
+		return nil
+	}
+	zoomed, release, err := l.scaled(scale)
+	if err != nil {
+		return err
+	}
+	defer release()
+	zoomed.draw(zoomed.renderer, img, zoomed.lines, zoomed.origins, at.frame)
+	return nil
+}
+
+// bounce and wave heights as a share of the line height
+const (
+	bounceHeight = 0.3
+	waveHeight   = 0.15
+)
+
+func renderBounce(l textLayout, img *image.RGBA, at effectTime) error {
+	letters, origins := l.letters()
+	t := at.cycle()
+	for i := range origins {
+		// each letter hops half a period after the one before it
+		phase := 2 * math.Pi * (t - float64(i)/float64(2*len(letters)))
+		origins[i].Y -= int(math.Round(math.Abs(math.Sin(phase)) * bounceHeight * float64(l.lineHeight)))
+	}
+	l.draw(l.renderer, img, letters, origins, at.frame)
+	return nil
+}
+
+func renderWave(l textLayout, img *image.RGBA, at effectTime) error {
+	letters, origins := l.letters()
+	t := at.cycle()
+	for i := range origins {
+		phase := 2 * math.Pi * (t - float64(i)/8)
+		origins[i].Y += int(math.Round(math.Sin(phase) * waveHeight * float64(l.lineHeight)))
+	}
+	l.draw(l.renderer, img, letters, origins, at.frame)
+	return nil
+}
+
+// renderRainbow colors every letter with an evenly bright OKLCh hue that
+// moves along the text over the loop
+func renderRainbow(l textLayout, img *image.RGBA, at effectTime) error {
+	letters, origins := l.letters()
+	t := at.cycle()
+	tr := l.renderer
+	tr.composite(img, func(layer *image.RGBA) {
+		for i, letter := range letters {
+			tr.renderWithOutline(layer, letter, origins[i].X, origins[i].Y, color.Black)
+		}
+		for i, letter := range letters {
+			hue := 2 * math.Pi * (t + float64(i)/float64(len(letters)))
+			c := OKLab{L: 0.75, A: 0.15 * math.Cos(hue), B: 0.15 * math.Sin(hue)}.toRGBA()
+			tr.renderText(layer, letter, origins[i].X, origins[i].Y, c)
+		}
+	})
+	return nil
+}
+
+func renderShake(l textLayout, img *image.RGBA, at effectTime) error {
+	rng := frameRand(l.renderer.seed, at.frame)
+	amount := max(1, l.lineHeight/12)
+	dx, dy := rng.IntN(2*amount+1)-amount, rng.IntN(2*amount+1)-amount
+	l.draw(l.renderer, img, l.lines, l.shifted(dx, dy), at.frame)
+	return nil
+}
+
+func renderCursor(l textLayout, img *image.RGBA, at effectTime) error {
+	l.draw(l.renderer, img, l.lines, l.origins, at.frame)
+	// -duration sets the length of one blink
+	if at.t < at.duration/2 {
+		last := len(l.lines) - 1
+		l.cursorAt(img, l.origins[last].X+l.advance(l.lines[last]), l.origins[last].Y, at.frame)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// image filters shared by text styles and backgrounds
+package main
+
+import (
+	"image"
+)
+
+// boxBlur approximates a gaussian blur with three box blur passes. It works
+// on premultiplied pixels so transparent layers blur without dark fringes
+func boxBlur(src *image.RGBA, radius int) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	if radius <= 0 {
+		return dst
+	}
+
+	tmp := image.NewRGBA(src.Bounds())
+	for range 3 {
+		blurPass(tmp, dst, radius, true)
+		blurPass(dst, tmp, radius, false)
+	}
+	return dst
+}
+
+// blurPass runs a moving-average window along rows or columns, clamping
+// samples at the image edges
+func blurPass(dst, src *image.RGBA, radius int, horizontal bool) {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lines, length := h, w
+	if !horizontal {
+		lines, length = w, h
+	}
+	window := 2*radius + 1
+
+	offset := func(line, i int) int {
+		i = min(max(i, 0), length-1)
+		if horizontal {
+			return line*src.Stride + i*4
+		}
+		return i*src.Stride + line*4
+	}
+
+	for line := range lines {
+		var sum [4]int
+		for i := -radius; i <= radius; i++ {
+			o := offset(line, i)
+			for c := range 4 {
+				sum[c] += int(src.Pix[o+c])
+			}
+		}
+		for i := range length {
+			o := offset(line, i)
+			for c := range 4 {
+				dst.Pix[o+c] = uint8(sum[c] / window)
+			}
+			out, in := offset(line, i-radius), offset(line, i+radius+1)
+			for c := range 4 {
+				sum[c] += int(src.Pix[in+c]) - int(src.Pix[out+c])
+			}
+		}
+	}
+}
+
+// scaleAlpha multiplies every pixel of a premultiplied image by gain,
+// clamping so colors never exceed their alpha
+func scaleAlpha(img *image.RGBA, gain float64) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := min(float64(img.Pix[i+3])*gain, 255)
+		scale := 0.0
+		if img.Pix[i+3] > 0 {
+			scale = a / float64(img.Pix[i+3])
+		}
+		for c := range 3 {
+			img.Pix[i+c] = uint8(min(float64(img.Pix[i+c])*scale, a))
+		}
+		img.Pix[i+3] = uint8(a)
+	}
+}
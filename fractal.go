@@ -0,0 +1,198 @@
+// fractal backgrounds: Mandelbrot and Julia sets and IFS flame attractors
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// float64 coordinates near the set are only about 2e-16 apart, at 1e12 a
+// 1080 pixel high image still has a dozen of them per pixel and deeper
+// zooms turn into flat blocks
+const maxEscapeZoom = 1e12
+
+// parameters shared by the escape time fractals
+var escapeParamSpecs = []ParamSpec{
+	{Name: "zoom", Default: "1", Min: 0.01, Max: maxEscapeZoom, Help: "magnification, 1 shows three units of the plane vertically"},
+	{Name: "iterations", Kind: paramInt, Default: "300", Min: 10, Max: 100000, Help: "iteration cap"},
+	{Name: "cycles", Default: "1", Min: 0.1, Max: 50, Help: "times the palette repeats across the escape range"},
+}
+
+// escapeTime iterates z = z^2 + c and returns a smooth iteration count, or
+// -1 when the point doesn't escape within maxIter
+func escapeTime(zr, zi, cr, ci float64, maxIter int) float64 {
+	for n := range maxIter {
+		zr2, zi2 := zr*zr, zi*zi
+		// a large bailout radius makes the smooth count accurate
+		if zr2+zi2 > 256 {
+			return float64(n) + 1 - math.Log2(math.Log(zr2+zi2)/2)
+		}
+		zr, zi = zr2-zi2+cr, 2*zr*zi+ci
+	}
+	return -1
+}
+
+// escapeBackground maps every pixel onto the complex plane around a center
+// and colors it by its escape time
+func escapeBackground(w, h int, params BackgroundParams, iterate func(re, im float64) float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	maxIter := params.Int("iterations")
+	cycles := params.Float("cycles")
+	// three units of the plane fit the height at zoom 1
+	unit := 3 / params.Float("zoom") / float64(h)
+	cx, cy := params.Float("cx"), params.Float("cy")
+	inside := params.Palette[0]
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		re := cx + (float64(x)-float64(w)/2)*unit
+		im := cy + (float64(y)-float64(h)/2)*unit
+
+		nu := iterate(re, im)
+		if nu < 0 {
+			return inside
+		}
+		// the square root spreads the colors of the fast escaping outside
+		t := math.Mod(math.Sqrt(nu/float64(maxIter))*cycles, 1)
+		return samplePalette(params.Palette, t)
+	})
+	return img
+}
+
+func generateMandelbrotBackground(w, h int, params BackgroundParams) *image.RGBA {
+	maxIter := params.Int("iterations")
+	return escapeBackground(w, h, params, func(re, im float64) float64 {
+		return escapeTime(0, 0, re, im, maxIter)
+	})
+}
+
+func generateJuliaBackground(w, h int, params BackgroundParams) *image.RGBA {
+	maxIter := params.Int("iterations")
+	cr, ci := params.Float("cr"), params.Float("ci")
+	return escapeBackground(w, h, params, func(re, im float64) float64 {
+		return escapeTime(re, im, cr, ci, maxIter)
+	})
+}
+
+// flameTransform is an affine map followed by a nonlinear variation
+type flameTransform struct {
+	a, b, c, d, e, f float64
+	variation        func(x, y float64) (float64, float64)
+	color            float64
+}
+
+// variations from the fractal flame paper by Draves and Reckase
+var flameVariations = []func(x, y float64) (float64, float64){
+	// linear
+	func(x, y float64) (float64, float64) { return x, y },
+	// sinusoidal
+	func(x, y float64) (float64, float64) { return math.Sin(x), math.Sin(y) },
+	// spherical
+	func(x, y float64) (float64, float64) {
+		r2 := x*x + y*y + 1e-9
+		return x / r2, y / r2
+	},
+	// swirl
+	func(x, y float64) (float64, float64) {
+		r2 := x*x + y*y
+		s, c := math.Sincos(r2)
+		return x*s - y*c, x*c + y*s
+	},
+	// horseshoe
+	func(x, y float64) (float64, float64) {
+		r := math.Hypot(x, y) + 1e-9
+		return (x - y) * (x + y) / r, 2 * x * y / r
+	},
+}
+
+// flame attractor rendered with the chaos game into a log density histogram
+func generateFlameBackground(w, h int, params BackgroundParams) *image.RGBA {
+	rng := rand.New(rand.NewPCG(uint64(params.Seed), 0xf1a3e))
+	transforms := make([]flameTransform, params.Int("transforms"))
+	for i := range transforms {
+		t := &transforms[i]
+		t.a, t.b, t.c = rng.Float64()*2-1, rng.Float64()*2-1, rng.Float64()*2-1
+		t.d, t.e, t.f = rng.Float64()*2-1, rng.Float64()*2-1, rng.Float64()*2-1
+		t.variation = flameVariations[rng.IntN(len(flameVariations))]
+		t.color = float64(i) / float64(max(len(transforms)-1, 1))
+	}
+
+	step := func(x, y, c float64) (float64, float64, float64) {
+		t := transforms[rng.IntN(len(transforms))]
+		x, y = t.variation(t.a*x+t.b*y+t.c, t.d*x+t.e*y+t.f)
+		return x, y, (c + t.color) / 2
+	}
+
+	// frame the attractor by the bulk of a trial run, ignoring outliers
+	x, y, c := rng.Float64()*2-1, rng.Float64()*2-1, 0.5
+	var xs, ys []float64
+	for i := range 20000 {
+		x, y, c = step(x, y, c)
+		if i > 20 && finite(x, y) {
+			xs, ys = append(xs, x), append(ys, y)
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	background := params.Palette[0]
+	if len(xs) == 0 {
+		fillRGBA(img, background)
+		return img
+	}
+	slices.Sort(xs)
+	slices.Sort(ys)
+	lo, hi := len(xs)/50, len(xs)-1-len(xs)/50
+	minX, spanX := xs[lo], xs[hi]-xs[lo]+1e-9
+	minY, spanY := ys[lo], ys[hi]-ys[lo]+1e-9
+	// keep the aspect ratio and leave a margin
+	scale := 0.9 * math.Min(float64(w)/spanX, float64(h)/spanY)
+	offX := (float64(w) - spanX*scale) / 2
+	offY := (float64(h) - spanY*scale) / 2
+
+	counts := make([]float64, w*h)
+	colors := make([]float64, w*h)
+	samples := int(params.Float("density") * float64(w*h))
+	// the chaos game is one sequence of samples, only the pixels below are
+	// drawn in parallel
+	for i := range samples {
+		x, y, c = step(x, y, c)
+		if !finite(x, y) {
+			// escaped to infinity, restart the orbit
+			x, y = rng.Float64()*2-1, rng.Float64()*2-1
+			continue
+		}
+		if i < 20 {
+			continue
+		}
+		px := int((x-minX)*scale + offX)
+		py := int((y-minY)*scale + offY)
+		if px >= 0 && px < w && py >= 0 && py < h {
+			counts[py*w+px]++
+			colors[py*w+px] += c
+		}
+	}
+
+	maxCount := slices.Max(counts)
+	gamma := params.Float("gamma")
+	fillPixels(img, func(px, py int) color.RGBA {
+		n := counts[py*w+px]
+		if n == 0 {
+			return background
+		}
+		alpha := math.Pow(math.Log1p(n)/math.Log1p(maxCount), 1/gamma)
+		fg := samplePalette(params.Palette, colors[py*w+px]/n)
+		return interpolateColor(background, fg, alpha)
+	})
+	return img
+}
+
+func finite(x, y float64) bool {
+	return !math.IsNaN(x) && !math.IsNaN(y) && !math.IsInf(x, 0) && !math.IsInf(y, 0)
+}
+
+func fillRGBA(img *image.RGBA, c color.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+}
@@ -0,0 +1,54 @@
+// frame differencing of full color frames, shared by the APNG and WebP
+// writers
+package main
+
+import (
+	"bytes"
+	"image"
+)
+
+// grow extends r to cover the pixel at x, y
+func grow(r image.Rectangle, x, y int) image.Rectangle {
+	if r.Empty() {
+		return image.Rect(x, y, x+1, y+1)
+	}
+	return image.Rect(min(r.Min.X, x), min(r.Min.Y, y), max(r.Max.X, x+1), max(r.Max.Y, y+1))
+}
+
+// frameDelta crops cur to the rectangle that changed since prev, its corner
+// rounded down to a multiple of align. When every changed pixel is opaque
+// the unchanged ones are left transparent to be drawn over the canvas,
+// otherwise the rectangle replaces the canvas
+func frameDelta(prev, cur *image.RGBA, align int) (*image.RGBA, bool) {
+	var changed image.Rectangle
+	over := true
+	b := cur.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := cur.PixOffset(x, y)
+			if bytes.Equal(prev.Pix[i:i+4], cur.Pix[i:i+4]) {
+				continue
+			}
+			changed = grow(changed, x, y)
+			over = over && cur.Pix[i+3] == 255
+		}
+	}
+	if changed.Empty() {
+		// an unchanged frame still holds its delay
+		return image.NewRGBA(image.Rect(b.Min.X, b.Min.Y, b.Min.X+1, b.Min.Y+1)), true
+	}
+	changed.Min.X -= (changed.Min.X - b.Min.X) % align
+	changed.Min.Y -= (changed.Min.Y - b.Min.Y) % align
+
+	delta := image.NewRGBA(changed)
+	for y := changed.Min.Y; y < changed.Max.Y; y++ {
+		for x := changed.Min.X; x < changed.Max.X; x++ {
+			i, j := cur.PixOffset(x, y), delta.PixOffset(x, y)
+			if over && bytes.Equal(prev.Pix[i:i+4], cur.Pix[i:i+4]) {
+				continue
+			}
+			copy(delta.Pix[j:j+4], cur.Pix[i:i+4])
+		}
+	}
+	return delta, over
+}
@@ -0,0 +1,350 @@
+// geometric backgrounds: low-poly triangulation, hexagons, circles,
+// chevrons, polka dots and stripes
+package main
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// paletteAt picks a palette color by index, wrapping in both directions
+func paletteAt(palette []color.RGBA, i int) color.RGBA {
+	i %= len(palette)
+	if i < 0 {
+		i += len(palette)
+	}
+	return palette[i]
+}
+
+// shadeColor scales the brightness of a color, clamping at white
+func shadeColor(c color.RGBA, f float64) color.RGBA {
+	scale := func(v uint8) uint8 {
+		return uint8(math.Max(0, math.Min(255, float64(v)*f)))
+	}
+	return color.RGBA{scale(c.R), scale(c.G), scale(c.B), c.A}
+}
+
+type point struct{ X, Y float64 }
+
+// triangle indexes three points and caches its circumcircle
+type triangle struct {
+	a, b, c int
+	cx, cy  float64
+	r2      float64
+}
+
+func newTriangle(pts []point, a, b, c int) triangle {
+	ax, ay := pts[a].X, pts[a].Y
+	bx, by := pts[b].X, pts[b].Y
+	cx, cy := pts[c].X, pts[c].Y
+	d := 2 * (ax*(by-cy) + bx*(cy-ay) + cx*(ay-by))
+	t := triangle{a: a, b: b, c: c}
+	if d == 0 {
+		// degenerate, make every point fall inside so it gets replaced
+		t.r2 = math.Inf(1)
+		return t
+	}
+	a2, b2, c2 := ax*ax+ay*ay, bx*bx+by*by, cx*cx+cy*cy
+	t.cx = (a2*(by-cy) + b2*(cy-ay) + c2*(ay-by)) / d
+	t.cy = (a2*(cx-bx) + b2*(ax-cx) + c2*(bx-ax)) / d
+	t.r2 = (ax-t.cx)*(ax-t.cx) + (ay-t.cy)*(ay-t.cy)
+	return t
+}
+
+// delaunay triangulates points with the Bowyer-Watson algorithm
+func delaunay(pts []point) []triangle {
+	n := len(pts)
+	// a super triangle that contains every point
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range pts {
+		minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+		maxX, maxY = math.Max(maxX, p.X), math.Max(maxY, p.Y)
+	}
+	span := math.Max(maxX-minX, maxY-minY) * 20
+	midX, midY := (minX+maxX)/2, (minY+maxY)/2
+	all := append(pts[:n:n], point{midX - span, midY - span}, point{midX, midY + span}, point{midX + span, midY - span})
+	tris := []triangle{newTriangle(all, n, n+1, n+2)}
+
+	for i := range n {
+		p := all[i]
+		edges := map[[2]int]int{}
+		kept := tris[:0]
+		for _, t := range tris {
+			if (p.X-t.cx)*(p.X-t.cx)+(p.Y-t.cy)*(p.Y-t.cy) < t.r2 {
+				for _, e := range [][2]int{{t.a, t.b}, {t.b, t.c}, {t.c, t.a}} {
+					edges[[2]int{min(e[0], e[1]), max(e[0], e[1])}]++
+				}
+				continue
+			}
+			kept = append(kept, t)
+		}
+		tris = kept
+		// edges of exactly one removed triangle bound the hole
+		for e, count := range edges {
+			if count == 1 {
+				tris = append(tris, newTriangle(all, e[0], e[1], i))
+			}
+		}
+	}
+
+	result := tris[:0]
+	for _, t := range tris {
+		if t.a < n && t.b < n && t.c < n {
+			result = append(result, t)
+		}
+	}
+	// map iteration made the order random, sort it for reproducible output
+	slices.SortFunc(result, func(t, u triangle) int {
+		return cmp.Or(cmp.Compare(t.a+t.b+t.c, u.a+u.b+u.c), cmp.Compare(min(t.a, t.b, t.c), min(u.a, u.b, u.c)),
+			cmp.Compare(max(t.a, t.b, t.c), max(u.a, u.b, u.c)))
+	})
+	return result
+}
+
+// flatTriangle is a single colored triangle clipped to the rows and columns of
+// the pixels it may cover
+type flatTriangle struct {
+	p0, p1, p2     point
+	area           float64
+	x0, x1, y0, y1 int
+	c              color.RGBA
+}
+
+// newFlatTriangle clips the triangle to bounds, it is empty when y0 > y1
+func newFlatTriangle(bounds image.Rectangle, p0, p1, p2 point, c color.RGBA) flatTriangle {
+	t := flatTriangle{p0: p0, p1: p1, p2: p2, c: c}
+	t.x0 = max(bounds.Min.X, int(math.Floor(min(p0.X, p1.X, p2.X))))
+	t.x1 = min(bounds.Max.X-1, int(math.Ceil(max(p0.X, p1.X, p2.X))))
+	t.y0 = max(bounds.Min.Y, int(math.Floor(min(p0.Y, p1.Y, p2.Y))))
+	t.y1 = min(bounds.Max.Y-1, int(math.Ceil(max(p0.Y, p1.Y, p2.Y))))
+	t.area = triangleEdge(p0, p1, p2.X, p2.Y)
+	if t.area == 0 {
+		t.y0, t.y1 = 0, -1
+	}
+	return t
+}
+
+func triangleEdge(a, b point, x, y float64) float64 {
+	return (b.X-a.X)*(y-a.Y) - (b.Y-a.Y)*(x-a.X)
+}
+
+// fillRow sets the pixels of row y whose center lies inside the triangle
+func (t flatTriangle) fillRow(img *image.RGBA, y int) {
+	py := float64(y) + 0.5
+	for x := t.x0; x <= t.x1; x++ {
+		px := float64(x) + 0.5
+		// same sign as the area means inside, whatever the winding
+		w0 := triangleEdge(t.p1, t.p2, px, py) * t.area
+		w1 := triangleEdge(t.p2, t.p0, px, py) * t.area
+		w2 := triangleEdge(t.p0, t.p1, px, py) * t.area
+		if w0 >= 0 && w1 >= 0 && w2 >= 0 {
+			i := img.PixOffset(x, y)
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = t.c.R, t.c.G, t.c.B, t.c.A
+		}
+	}
+}
+
+// low-poly background: a jittered lattice is triangulated and every
+// triangle takes the palette gradient color at its centroid
+func generateLowPolyBackground(w, h int, params BackgroundParams) *image.RGBA {
+	rng := rand.New(rand.NewPCG(uint64(params.Seed), 0x107b01))
+	// lattice in normalized coordinates so supersampling keeps the shapes
+	cols := max(1, int(math.Round(math.Sqrt(params.Float("points")*float64(w)/float64(h)))))
+	rows := max(1, int(math.Round(params.Float("points")/float64(cols))))
+	jitter := params.Float("jitter")
+
+	// the lattice reaches one cell past the canvas so its hull covers every
+	// pixel, and a tiny minimum jitter keeps the points in general position
+	jitter = math.Max(jitter, 1e-3)
+	var pts []point
+	for j := -1; j <= rows+1; j++ {
+		for i := -1; i <= cols+1; i++ {
+			u := (float64(i) + (rng.Float64()-0.5)*jitter) / float64(cols)
+			v := (float64(j) + (rng.Float64()-0.5)*jitter) / float64(rows)
+			pts = append(pts, point{u * float64(w), v * float64(h)})
+		}
+	}
+
+	lut := gradientLUT(evenStops(params.Palette), "oklab")
+	theta := params.Float("angle") * math.Pi / 180
+	dx, dy := math.Cos(theta), math.Sin(theta)
+	halfLength := (math.Abs(float64(w)*dx) + math.Abs(float64(h)*dy)) / 2
+	variance := params.Float("variance")
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	// triangles by the rows they cover, in drawing order so shared edges
+	// go to the same triangle whichever worker fills the row
+	rowTriangles := make([][]flatTriangle, h)
+	for _, t := range delaunay(pts) {
+		p0, p1, p2 := pts[t.a], pts[t.b], pts[t.c]
+		mx, my := (p0.X+p1.X+p2.X)/3, (p0.Y+p1.Y+p2.Y)/3
+		pos := 0.5 + ((mx-float64(w)/2)*dx+(my-float64(h)/2)*dy)/(2*halfLength)
+		c := lut[int(math.Max(0, math.Min(1, pos))*float64(gradientLUTSize-1)+0.5)]
+		hash := hashCell(t.a+t.b+t.c, min(t.a, t.b, t.c)*len(pts)+max(t.a, t.b, t.c), params.Seed)
+		c = shadeColor(c, 1+(float64(hash>>40)/(1<<24)*2-1)*variance)
+		tri := newFlatTriangle(img.Rect, p0, p1, p2, c)
+		for y := tri.y0; y <= tri.y1; y++ {
+			rowTriangles[y] = append(rowTriangles[y], tri)
+		}
+	}
+	parallelRows(h, func(y int) {
+		for _, tri := range rowTriangles[y] {
+			tri.fillRow(img, y)
+		}
+	})
+	return img
+}
+
+// hexagon tiling with pointy-top cells colored from the palette
+func generateHexagonBackground(w, h int, params BackgroundParams) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	size := params.Float("size")
+	border := params.Float("border")
+	palette := params.Palette
+	lead := shadeColor(palette[0], 0.5)
+	sqrt3 := math.Sqrt(3)
+
+	// when tiling, stretch so whole columns and pairs of rows fit the canvas
+	stretchX, stretchY := 1.0, 1.0
+	var cols, rows int
+	if params.Tileable {
+		logicalW, logicalH := float64(w)/params.PixelScale, float64(h)/params.PixelScale
+		var fittedW, fittedH float64
+		fittedW, cols = fitPeriod(logicalW, sqrt3*size)
+		fittedH, rows = fitPeriod(logicalH, 3*size)
+		stretchX, stretchY = sqrt3*size/fittedW, 3*size/fittedH
+		rows *= 2
+	}
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		lx := float64(x) / params.PixelScale * stretchX
+		ly := float64(y) / params.PixelScale * stretchY
+		// fractional axial coordinates, rounded through cube coordinates
+		q := (sqrt3/3*lx - ly/3) / size
+		r := (2.0 / 3 * ly) / size
+		rq, rr, rs := math.Round(q), math.Round(r), math.Round(-q-r)
+		dq, dr, ds := math.Abs(rq-q), math.Abs(rr-r), math.Abs(rs+q+r)
+		if dq > dr && dq > ds {
+			rq = -rr - rs
+		} else if dr > ds {
+			rr = -rq - rs
+		}
+
+		// distance from the cell edge, the inradius minus the hex norm
+		cx := size * sqrt3 * (rq + rr/2)
+		cy := size * 1.5 * rr
+		ox, oy := lx-cx, ly-cy
+		norm := math.Max(math.Abs(ox), math.Max(math.Abs(ox/2+oy*sqrt3/2), math.Abs(ox/2-oy*sqrt3/2)))
+		if size*sqrt3/2-norm < border/2 {
+			return lead
+		}
+		// offset coordinates stay the same one tile period apart
+		col := wrapIndex(int(rq)+int(math.Floor(rr/2)), cols)
+		row := wrapIndex(int(rr), rows)
+		if !params.Tileable {
+			col, row = int(rq), int(rr)
+		}
+		return palette[hashCell(col, row, params.Seed)>>32%uint64(len(palette))]
+	})
+	return img
+}
+
+// concentric rings around a center, cycling through the palette
+func generateCirclesBackground(w, h int, params BackgroundParams) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	spacing := params.Float("spacing") * params.PixelScale
+	cx, cy := float64(w)*params.Float("cx"), float64(h)*params.Float("cy")
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+		return paletteAt(params.Palette, int(d/spacing))
+	})
+	return img
+}
+
+// chevron bands zigzagging across the canvas
+func generateChevronBackground(w, h int, params BackgroundParams) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	band := params.Float("band")
+	width := params.Float("width")
+	height := params.Float("height")
+	if params.Tileable {
+		// whole zigzags across and whole palette cycles down the canvas
+		n := float64(len(params.Palette))
+		width, _ = fitPeriod(float64(w)/params.PixelScale, width)
+		band, _ = fitPeriod(float64(h)/params.PixelScale, band*n)
+		band /= n
+	}
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		lx, ly := float64(x)/params.PixelScale, float64(y)/params.PixelScale
+		// triangle wave between 0 and 1 along x
+		phase := lx/width - math.Floor(lx/width)
+		tri := math.Abs(2*phase - 1)
+		pos := ly + tri*height
+		return paletteAt(params.Palette, int(math.Floor(pos/band)))
+	})
+	return img
+}
+
+// polka dots on the first palette color, the dots take the others
+func generateDotsBackground(w, h int, params BackgroundParams) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	spacing := params.Float("spacing")
+	radius := params.Float("radius") * spacing / 2
+	staggered := params.String("layout") == "staggered"
+	palette := params.Palette
+	// palettes have at least minPaletteColors colors, so some are left for
+	// the dots
+	dots := palette[1:]
+
+	spacingX, spacingY := spacing, spacing
+	var cols, rows int
+	if params.Tileable {
+		spacingX, cols = fitPeriod(float64(w)/params.PixelScale, spacing)
+		// staggered rows repeat in pairs
+		spacingY, rows = fitPeriod(float64(h)/params.PixelScale, 2*spacing)
+		spacingY, rows = spacingY/2, rows*2
+	}
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		lx, ly := float64(x)/params.PixelScale, float64(y)/params.PixelScale
+		row := math.Floor(ly / spacingY)
+		if staggered && int(row)%2 != 0 {
+			lx += spacingX / 2
+		}
+		col := math.Floor(lx / spacingX)
+		ox := lx - (col+0.5)*spacingX
+		oy := ly - (row+0.5)*spacingY
+		if ox*ox+oy*oy < radius*radius {
+			cell := hashCell(wrapIndex(int(col), cols), wrapIndex(int(row), rows), params.Seed)
+			return dots[cell>>32%uint64(len(dots))]
+		}
+		return palette[0]
+	})
+	return img
+}
+
+// flat stripes at any angle, one palette color per stripe
+func generateStripesBackground(w, h int, params BackgroundParams) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	width := params.Float("width")
+	palette := params.Colors("colors", params.Palette)
+	theta := params.Float("angle") * math.Pi / 180
+	nx, ny := math.Cos(theta), math.Sin(theta)
+	if params.Tileable {
+		// nudge the angle so the colors line up across both edges
+		period := width * float64(len(palette))
+		nx, ny = fitDirection(nx, ny, float64(w)/params.PixelScale, float64(h)/params.PixelScale, period)
+	}
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		pos := ((float64(x)+0.5)*nx + (float64(y)+0.5)*ny) / params.PixelScale
+		return paletteAt(palette, int(math.Floor(pos/width)))
+	})
+	return img
+}
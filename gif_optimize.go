@@ -0,0 +1,165 @@
+// GIF frame differencing that stores only the changed part of each frame,
+// and the size report printed after writing
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+)
+
+// paletteColors converts a palette to comparable straight colors, with every
+// fully transparent entry as the zero color
+func paletteColors(palette color.Palette) []color.RGBA {
+	colors := make([]color.RGBA, len(palette))
+	for i, c := range palette {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		if rgba.A != 0 {
+			colors[i] = rgba
+		}
+	}
+	return colors
+}
+
+// transparentIndex is the first fully transparent palette entry, or -1
+func transparentIndex(colors []color.RGBA) int {
+	for i, c := range colors {
+		if c.A == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// share of the pixels frames must repeat from the frame before them for
+// frame differencing to be worth a GIF palette entry, moving backgrounds
+// repeat well below it
+const minRepeatedPixels = 0.01
+
+// repeatsPixels reports whether the frames keep enough pixels of the frame
+// before them that marking those transparent pays off
+func repeatsPixels(frames []*image.RGBA) bool {
+	repeated, total := 0, 0
+	for i := 1; i < len(frames); i++ {
+		prev, cur := frames[i-1].Pix, frames[i].Pix
+		for p := 0; p < len(cur); p += 4 {
+			if [4]uint8(cur[p:p+4]) == [4]uint8(prev[p:p+4]) {
+				repeated++
+			}
+		}
+		total += len(cur) / 4
+	}
+	return total > 0 && float64(repeated) >= minRepeatedPixels*float64(total)
+}
+
+// optimizeFrames replaces every frame after the first with the rectangle
+// that changed since the frame before it, unchanged pixels inside it
+// transparent where the palette has a transparent entry, and returns the
+// disposal of each frame. Frames are full canvas images in playback order.
+//
+// Frames are kept on the canvas, except when the next one turns visible
+// pixels transparent: that frame's rectangle is widened over those pixels
+// and disposed to the background, so they are cleared before the next frame
+func optimizeFrames(frames []*image.Paletted) ([]*image.Paletted, []byte) {
+	n := len(frames)
+	colors := make([][]color.RGBA, n)
+	for i, frame := range frames {
+		colors[i] = paletteColors(frame.Palette)
+	}
+	at := func(i, x, y int) color.RGBA {
+		frame := frames[i]
+		return colors[i][frame.Pix[frame.PixOffset(x, y)]]
+	}
+	bounds := frames[0].Rect
+
+	// changed and vanishing pixels between a frame and the one after it, the
+	// last frame is followed by the first when the animation loops
+	rects := make([]image.Rectangle, n)
+	disposal := make([]byte, n)
+	rects[0] = bounds
+	for i := range n {
+		disposal[i] = gif.DisposalNone
+	}
+	for i := 1; i <= n && n > 1; i++ {
+		prev, cur := i-1, i%n
+		var changed, vanished, visible image.Rectangle
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				a, b := at(prev, x, y), at(cur, x, y)
+				if b.A != 0 {
+					visible = grow(visible, x, y)
+				}
+				if a == b {
+					continue
+				}
+				changed = grow(changed, x, y)
+				if b.A == 0 {
+					vanished = grow(vanished, x, y)
+				}
+			}
+		}
+		if !vanished.Empty() {
+			disposal[prev] = gif.DisposalBackground
+			rects[prev] = rects[prev].Union(vanished)
+			// the cleared area has to be drawn again
+			changed = changed.Union(rects[prev].Intersect(visible))
+		}
+		if cur == 0 {
+			break
+		}
+		if changed.Empty() {
+			// an unchanged frame still holds its delay
+			changed = image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+1, bounds.Min.Y+1)
+		}
+		rects[cur] = changed
+	}
+
+	optimized := make([]*image.Paletted, n)
+	optimized[0] = frames[0]
+	for i := 1; i < n; i++ {
+		frame, r := frames[i], rects[i]
+		keep := transparentIndex(colors[i])
+		cleared := rects[i-1]
+		if disposal[i-1] != gif.DisposalBackground {
+			cleared = image.Rectangle{}
+		}
+
+		delta := image.NewPaletted(r, frame.Palette)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				// what the canvas shows before this frame is drawn
+				shown := at(i-1, x, y)
+				if (image.Point{x, y}).In(cleared) {
+					shown = color.RGBA{}
+				}
+				index := frame.Pix[frame.PixOffset(x, y)]
+				if keep >= 0 && colors[i][index] == shown {
+					index = uint8(keep)
+				}
+				delta.Pix[delta.PixOffset(x, y)] = index
+			}
+		}
+		optimized[i] = delta
+	}
+	return optimized, disposal
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// formatBytes writes a size in bytes, KB or MB
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
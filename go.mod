@@ -2,6 +2,9 @@ module github.com/khethan-god/tti
 
 go 1.24.2
 
-require golang.org/x/image v0.27.0
+require (
+	golang.org/x/image v0.27.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require golang.org/x/text v0.25.0 // indirect
@@ -0,0 +1,189 @@
+// linear, radial and conic gradient backgrounds
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GradientStop is a color at a position between 0 and 1
+type GradientStop struct {
+	Color    color.RGBA
+	Position float64
+}
+
+// colors are precomputed into a lookup table of this many entries
+const gradientLUTSize = 1024
+
+// parameters shared by all gradient generators
+var gradientParamSpecs = []ParamSpec{
+	{Name: "stops", Kind: paramStops, Help: "colors with optional positions such as ff0000@0/00ff00@0.3/0000ff, empty spreads the palette"},
+	{Name: "space", Kind: paramChoice, Default: "oklab", Choices: []string{"srgb", "linear", "oklab"}, Help: "color space used for interpolation"},
+}
+
+// parseGradientStops parses slash separated "color[@position]" stops.
+// Missing positions are spread evenly between their neighbours
+func parseGradientStops(val string) ([]GradientStop, error) {
+	if val == "" {
+		return nil, nil
+	}
+	parts := strings.Split(val, "/")
+	if len(parts) < 2 {
+		return nil, errors.New("a gradient needs at least two stops")
+	}
+
+	stops := make([]GradientStop, len(parts))
+	known := make([]bool, len(parts))
+	for i, part := range parts {
+		hex, pos, hasPos := strings.Cut(part, "@")
+		c, err := parseHexColor(hex)
+		if err != nil {
+			return nil, err
+		}
+		stops[i].Color = c
+		if hasPos {
+			p, err := strconv.ParseFloat(pos, 64)
+			if err != nil || p < 0 || p > 1 {
+				return nil, errors.New("stop position must be between 0 and 1: " + part)
+			}
+			stops[i].Position = p
+			known[i] = true
+		}
+	}
+	if !known[0] {
+		stops[0].Position, known[0] = 0, true
+	}
+	if last := len(stops) - 1; !known[last] {
+		stops[last].Position, known[last] = 1, true
+	}
+
+	// fill gaps between known stops, then keep positions ascending like CSS
+	for i := 0; i < len(stops); {
+		j := i + 1
+		for j < len(stops) && !known[j] {
+			j++
+		}
+		for k := i + 1; k < j; k++ {
+			t := float64(k-i) / float64(j-i)
+			stops[k].Position = stops[i].Position + t*(stops[j].Position-stops[i].Position)
+		}
+		i = j
+	}
+	for i := 1; i < len(stops); i++ {
+		stops[i].Position = math.Max(stops[i].Position, stops[i-1].Position)
+	}
+	return stops, nil
+}
+
+// evenStops spreads colors evenly between 0 and 1
+func evenStops(colors []color.RGBA) []GradientStop {
+	stops := make([]GradientStop, len(colors))
+	for i, c := range colors {
+		stops[i] = GradientStop{Color: c, Position: float64(i) / float64(max(len(colors)-1, 1))}
+	}
+	return stops
+}
+
+// gradientStops returns the stops parameter or the palette spread evenly
+func (p BackgroundParams) gradientStops() []GradientStop {
+	stops, _ := parseGradientStops(p.Values["stops"])
+	if len(stops) == 0 {
+		return evenStops(p.Palette)
+	}
+	return stops
+}
+
+// interpolateIn mixes two colors in the named color space
+func interpolateIn(space string, c1, c2 color.RGBA, t float64) color.RGBA {
+	switch space {
+	case "linear":
+		mix := func(a, b uint8) uint8 {
+			return linearToSRGB8(lerp(srgbToLinear(a), srgbToLinear(b), t))
+		}
+		return color.RGBA{mix(c1.R, c2.R), mix(c1.G, c2.G), mix(c1.B, c2.B), 255}
+	case "oklab":
+		a, b := rgbaToOKLab(c1), rgbaToOKLab(c2)
+		return OKLab{lerp(a.L, b.L, t), lerp(a.A, b.A, t), lerp(a.B, b.B, t)}.toRGBA()
+	default:
+		return interpolateColor(c1, c2, t)
+	}
+}
+
+// gradientLUT precomputes colors for positions 0 to 1
+func gradientLUT(stops []GradientStop, space string) []color.RGBA {
+	lut := make([]color.RGBA, gradientLUTSize)
+	for i := range lut {
+		t := float64(i) / float64(gradientLUTSize-1)
+		next := 0
+		for next < len(stops) && stops[next].Position < t {
+			next++
+		}
+		switch {
+		case next == 0:
+			lut[i] = stops[0].Color
+		case next == len(stops):
+			lut[i] = stops[len(stops)-1].Color
+		default:
+			a, b := stops[next-1], stops[next]
+			f := 0.0
+			if span := b.Position - a.Position; span > 0 {
+				f = (t - a.Position) / span
+			}
+			lut[i] = interpolateIn(space, a.Color, b.Color, f)
+		}
+	}
+	return lut
+}
+
+// gradientBackground colors each pixel by the gradient position from pos
+func gradientBackground(w, h int, params BackgroundParams, pos func(x, y float64) float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	lut := gradientLUT(params.gradientStops(), params.String("space"))
+
+	fillPixels(img, func(x, y int) color.RGBA {
+		// sample pixel centers so the result is symmetric
+		t := math.Max(0, math.Min(1, pos(float64(x)+0.5, float64(y)+0.5)))
+		return lut[int(t*float64(gradientLUTSize-1)+0.5)]
+	})
+	return img
+}
+
+// linear gradient along an angle, 0 degrees runs left to right and 90 top
+// to bottom. The gradient line spans the whole canvas like CSS
+func generateLinearGradientBackground(w, h int, params BackgroundParams) *image.RGBA {
+	theta := params.Float("angle") * math.Pi / 180
+	dx, dy := math.Cos(theta), math.Sin(theta)
+	cx, cy := float64(w)/2, float64(h)/2
+	halfLength := (math.Abs(float64(w)*dx) + math.Abs(float64(h)*dy)) / 2
+
+	return gradientBackground(w, h, params, func(x, y float64) float64 {
+		return 0.5 + ((x-cx)*dx+(y-cy)*dy)/(2*halfLength)
+	})
+}
+
+// radial gradient from a center, radius is a fraction of the distance to
+// the farthest corner
+func generateRadialGradientBackground(w, h int, params BackgroundParams) *image.RGBA {
+	cx, cy := float64(w)*params.Float("cx"), float64(h)*params.Float("cy")
+	farthest := math.Hypot(math.Max(cx, float64(w)-cx), math.Max(cy, float64(h)-cy))
+	radius := farthest * params.Float("radius")
+
+	return gradientBackground(w, h, params, func(x, y float64) float64 {
+		return math.Hypot(x-cx, y-cy) / radius
+	})
+}
+
+// conic gradient sweeping clockwise around a center from a start angle
+func generateConicGradientBackground(w, h int, params BackgroundParams) *image.RGBA {
+	cx, cy := float64(w)*params.Float("cx"), float64(h)*params.Float("cy")
+	start := params.Float("angle") * math.Pi / 180
+
+	return gradientBackground(w, h, params, func(x, y float64) float64 {
+		a := math.Atan2(y-cy, x-cx) - start
+		return math.Mod(a/(2*math.Pi)+2, 1)
+	})
+}
@@ -0,0 +1,117 @@
+// backgrounds made from user supplied images
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// imageFitFunc places src onto dst. scale is the supersampling factor, used
+// by the modes that keep the image at its native size
+type imageFitFunc func(dst *image.RGBA, src image.Image, scale float64)
+
+// Image fit mapping
+var imageFitMap = map[string]imageFitFunc{
+	"cover":   fitCover,
+	"contain": fitContain,
+	"stretch": fitStretch,
+	"tile":    fitTile,
+	"center":  fitCenter,
+}
+
+// ImageAdjustments soften a photo so text on top of it stays legible
+type ImageAdjustments struct {
+	Blur       float64 // blur radius in pixels
+	Darken     float64 // 0 keeps the image, 1 makes it black
+	Desaturate float64 // 0 keeps the colors, 1 makes it grayscale
+}
+
+func getImageFitModes() []string {
+	return getSortedKeys(imageFitMap)
+}
+
+// newImageBackground turns a decoded image into a background generator
+func newImageBackground(src image.Image, fit string, adjust ImageAdjustments) BackgroundGenFunc {
+	fitImage := getValueOrDefault(fit, imageFitMap, fitCover)
+	return func(w, h int, params BackgroundParams) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+		fitImage(img, src, params.PixelScale)
+		adjustImage(img, adjust, params.PixelScale)
+		return img
+	}
+}
+
+// fitCover scales the image to fill the canvas, cropping the overflow
+func fitCover(dst *image.RGBA, src image.Image, _ float64) {
+	sb, db := src.Bounds(), dst.Bounds()
+	scale := max(float64(db.Dx())/float64(sb.Dx()), float64(db.Dy())/float64(sb.Dy()))
+	// the part of the source that is visible after scaling, centered and at
+	// least a pixel so tiny images still fill the canvas
+	cw, ch := max(int(float64(db.Dx())/scale), 1), max(int(float64(db.Dy())/scale), 1)
+	crop := image.Rect(0, 0, cw, ch).Add(sb.Min).Add(image.Pt((sb.Dx()-cw)/2, (sb.Dy()-ch)/2))
+	xdraw.CatmullRom.Scale(dst, db, src, crop, draw.Src, nil)
+}
+
+// fitContain scales the whole image into the canvas, letterboxing the rest
+func fitContain(dst *image.RGBA, src image.Image, _ float64) {
+	sb, db := src.Bounds(), dst.Bounds()
+	scale := min(float64(db.Dx())/float64(sb.Dx()), float64(db.Dy())/float64(sb.Dy()))
+	w, h := max(int(float64(sb.Dx())*scale), 1), max(int(float64(sb.Dy())*scale), 1)
+	r := image.Rect(0, 0, w, h).Add(image.Pt((db.Dx()-w)/2, (db.Dy()-h)/2))
+	xdraw.CatmullRom.Scale(dst, r, src, sb, draw.Over, nil)
+}
+
+func fitStretch(dst *image.RGBA, src image.Image, _ float64) {
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+}
+
+// fitTile repeats the image at its native size from the top left corner
+func fitTile(dst *image.RGBA, src image.Image, scale float64) {
+	tile := nativeSize(src, scale)
+	tb := tile.Bounds()
+	for y := 0; y < dst.Bounds().Dy(); y += tb.Dy() {
+		for x := 0; x < dst.Bounds().Dx(); x += tb.Dx() {
+			draw.Draw(dst, tb.Add(image.Pt(x, y)), tile, image.Point{}, draw.Over)
+		}
+	}
+}
+
+// fitCenter places the image at its native size in the middle of the canvas
+func fitCenter(dst *image.RGBA, src image.Image, scale float64) {
+	img := nativeSize(src, scale)
+	b := img.Bounds()
+	offset := image.Pt((dst.Bounds().Dx()-b.Dx())/2, (dst.Bounds().Dy()-b.Dy())/2)
+	draw.Draw(dst, b.Add(offset), img, image.Point{}, draw.Over)
+}
+
+// nativeSize returns src at its own size times the supersampling factor
+func nativeSize(src image.Image, scale float64) *image.RGBA {
+	sb := src.Bounds()
+	w, h := max(int(float64(sb.Dx())*scale), 1), max(int(float64(sb.Dy())*scale), 1)
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(img, img.Bounds(), src, sb, draw.Src, nil)
+	return img
+}
+
+// adjustImage blurs, desaturates and darkens the image in place
+func adjustImage(img *image.RGBA, adjust ImageAdjustments, scale float64) {
+	if radius := int(adjust.Blur * scale); radius > 0 {
+		copy(img.Pix, boxBlur(img, radius).Pix)
+	}
+	if adjust.Darken == 0 && adjust.Desaturate == 0 {
+		return
+	}
+
+	keep := 1 - adjust.Darken
+	for i := 0; i < len(img.Pix); i += 4 {
+		r, g, b := float64(img.Pix[i]), float64(img.Pix[i+1]), float64(img.Pix[i+2])
+		luma := 0.299*r + 0.587*g + 0.114*b
+		img.Pix[i] = uint8((r + (luma-r)*adjust.Desaturate) * keep)
+		img.Pix[i+1] = uint8((g + (luma-g)*adjust.Desaturate) * keep)
+		img.Pix[i+2] = uint8((b + (luma-b)*adjust.Desaturate) * keep)
+	}
+}
@@ -8,15 +8,113 @@ import (
 	"image/draw"
 	"image/gif"
 	"image/png"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 
+	xdraw "golang.org/x/image/draw"
 	"golang.org/x/image/font"
 )
 
-func generateStaticImage(text string, config Config) error {
-	bgGen := getBackgroundGenerator(config.Background)
-	img := bgGen(config.Width, config.Height)
+// supersampledConfig returns the configuration used while drawing, scaled
+// up by the supersampling factor
+func supersampledConfig(config Config) Config {
+	scale := config.Supersample
+	config.Width *= scale
+	config.Height *= scale
+	config.FontSize *= float64(scale)
+	return config
+}
+
+func backgroundParams(config Config) BackgroundParams {
+	// validateConfig has already checked the background and resolved the palette
+	_, values, _ := parseBackground(config.Background)
+	return BackgroundParams{
+		PixelScale: float64(config.Supersample),
+		Seed:       config.Seed,
+		Palette:    config.palette,
+		Values:     values,
+		Tileable:   config.Tileable,
+	}
+}
+
+// resolveBackground returns the generator for the configured background,
+// a photo from -bg-image when given and a -bg pattern otherwise
+func resolveBackground(config Config) (BackgroundGenFunc, error) {
+	spec, _, _ := parseBackground(config.Background)
+	bgGen, wraps := spec.Generate, spec.Tileable
+	if !spec.Animated {
+		bgGen = paletteCycling(bgGen)
+	}
+	if config.BackgroundImage != "" {
+		src, err := loadImageFile(config.BackgroundImage)
+		if err != nil {
+			return nil, err
+		}
+		bgGen, wraps = newImageBackground(src, config.BackgroundFit, config.BackgroundAdjust), false
+	}
+	if config.Tileable && !wraps {
+		bgGen = makeTileable(bgGen)
+	}
+	if config.BackgroundOpacity >= 1 {
+		return bgGen, nil
+	}
+	return func(w, h int, params BackgroundParams) *image.RGBA {
+		img := bgGen(w, h, params)
+		scaleAlpha(img, config.BackgroundOpacity)
+		return img
+	}, nil
+}
+
+// newConfiguredRenderer creates a text renderer with the configured
+// outline scale, blend mode and layer opacity
+func newConfiguredRenderer(face font.Face, config Config) *TextRenderer {
+	renderer := NewTextRenderer(face)
+	renderer.outlineWidth = config.Supersample
+	renderer.blend = getBlendMode(config.BlendMode)
+	renderer.opacity = config.Opacity
+	renderer.seed = config.Seed
+
+	// validateConfig has already checked the color
+	renderer.neon.Color, _ = parseHexColor(config.NeonColor)
+	renderer.neon.Flicker = config.Flicker
+	renderer.glitch.Shift = config.GlitchShift
+	renderer.glitch.Slices = config.GlitchSlices
+	renderer.glitch.Scanlines = config.Scanlines
+	return renderer
+}
+
+// downsample scales a supersampled render back to the requested size
+func downsample(img *image.RGBA, config Config) *image.RGBA {
+	if config.Supersample <= 1 {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, config.Width, config.Height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	if !img.Opaque() {
+		// the filter can overshoot at alpha edges, keep colors premultiplied
+		for i := 0; i < len(dst.Pix); i += 4 {
+			a := dst.Pix[i+3]
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2] = min(dst.Pix[i], a), min(dst.Pix[i+1], a), min(dst.Pix[i+2], a)
+		}
+	}
+	return dst
+}
+
+func generateStaticImage(text string, outputConfig Config) error {
+	config := supersampledConfig(outputConfig)
+
+	bgGen, err := resolveBackground(config)
+	if err != nil {
+		return err
+	}
+	img := bgGen(config.Width, config.Height, backgroundParams(config))
+	if config.CheckSeams {
+		if err := checkSeams(img); err != nil {
+			return err
+		}
+	}
 
 	// Calculate optimal font size and get wrapped lines
 	primaryFace, _, lines, err := calculateOptimalFontSize(
@@ -26,7 +124,7 @@ func generateStaticImage(text string, config Config) error {
 	}
 	defer primaryFace.Close()
 
-	renderer := NewTextRenderer(primaryFace)
+	renderer := newConfiguredRenderer(primaryFace, config)
 
 	// Calculate positioning for multi-line text
 	metrics := primaryFace.Metrics()
@@ -40,32 +138,39 @@ func generateStaticImage(text string, config Config) error {
 		renderer.RenderRevealBackground(img, lines, -1, startY, lineHeight, false)
 	} else {
 		// Center each line individually
-		for i, line := range lines {
-			width, _ := measureText(line, primaryFace)
-			lineX := max((config.Width-width)/2, 0)
-			y := startY + i*lineHeight
-
-			renderer.renderWithOutline(img, line, lineX, y, color.Black)
-			renderer.renderText(img, line, lineX, y, color.White)
-		}
+		origins := renderer.lineOrigins(lines, config.Width, startY, lineHeight)
+		textStyleMap[config.Style](renderer, img, lines, origins, 0)
 	}
 
-	return saveImage(img, text, config.OutputDir)
+	if config.Format == "webp" {
+		return saveWebPImage(downsample(img, outputConfig), text, config.OutputDir)
+	}
+	return saveImage(downsample(img, outputConfig), text, config.OutputDir)
 }
 
 // Fixed generateAnimatedGIF function
-func generateAnimatedGIF(text string, config Config) error {
-	bgGen := getBackgroundGenerator(config.Background)
+func generateAnimatedGIF(text string, outputConfig Config) error {
+	config := supersampledConfig(outputConfig)
+	bgGen, err := resolveBackground(config)
+	if err != nil {
+		return err
+	}
+	bgParams := backgroundParams(config)
+	if config.CheckSeams {
+		if err := checkSeams(bgGen(config.Width, config.Height, bgParams)); err != nil {
+			return err
+		}
+	}
 
 	// calculate optimal font size and get wrapped lines
-	primaryFace, _, lines, err := calculateOptimalFontSize(
+	primaryFace, fontSize, lines, err := calculateOptimalFontSize(
 		text, config.FontStyle, config.Width, config.Height, config.FontSize)
 	if err != nil {
 		return err
 	}
 	defer primaryFace.Close()
 
-	renderer := NewTextRenderer(primaryFace)
+	renderer := newConfiguredRenderer(primaryFace, config)
 
 	// Calculate positioning for multi-line text (same as static version)
 	metrics := primaryFace.Metrics()
@@ -73,52 +178,142 @@ func generateAnimatedGIF(text string, config Config) error {
 	totalHeight := len(lines) * lineHeight
 
 	startY := max((config.Height-totalHeight)/2+metrics.Ascent.Ceil(), metrics.Ascent.Ceil())
+	origins := renderer.lineOrigins(lines, config.Width, startY, lineHeight)
+	canvas := image.Rect(0, 0, config.Width, config.Height)
+
+	layout := textLayout{
+		renderer:   renderer,
+		style:      textStyleMap[config.Style],
+		lines:      lines,
+		origins:    origins,
+		lineHeight: lineHeight,
+		fontStyle:  config.FontStyle,
+		fontSize:   fontSize,
+		width:      config.Width,
+		height:     config.Height,
+	}
 
-	// Generate four frames with different effects
-	frames := []*image.RGBA{
-		createFrame(bgGen, config, renderer, lines, primaryFace, startY, lineHeight, "outline"),
-		createFrame(bgGen, config, renderer, lines, primaryFace, startY, lineHeight, "reveal"),
-		createFrame(bgGen, config, renderer, lines, primaryFace, startY, lineHeight, "plain"),
-		createFrame(bgGen, config, renderer, lines, primaryFace, startY, lineHeight, "reveal-outline"),
+	// masks of the letters in each frame, to keep dithering out of them
+	var frames, crisp []*image.RGBA
+	var delays []int
+	if timeline := config.timeline; timeline != nil {
+		// validateConfig has already loaded the timeline and checked the background
+		bgSpec, _, _ := parseBackground(config.Background)
+		var layers []*image.RGBA
+		frames, layers, err = timeline.renderFrames(layout, bgGen, bgParams, bgSpec, float64(config.Supersample), config.AnimateBackground)
+		if err != nil {
+			return err
+		}
+		if config.CrispText {
+			crisp = layers
+		}
+		delays = frameDelays(len(frames), timeline.Duration)
+	} else if config.Effect != "classic" {
+		effect := effectMap[config.Effect]
+		duration := config.Duration
+		if duration == 0 {
+			duration = effect.Duration(layout)
+		}
+		n := frameCount(duration, config.FPS)
+		if n > maxAnimationFrames {
+			return fmt.Errorf("the %s effect would take %d frames, at most %d, lower -fps or -duration", config.Effect, n, maxAnimationFrames)
+		}
+		// validateConfig has already checked the easing
+		ease, _ := parseEasing(config.Easing)
+		background := frameBackgrounds(bgGen, bgParams, config, n)
+		frames, crisp, err = renderEffect(effect, layout, background, duration, config.FPS, ease, config.CrispText)
+		if err != nil {
+			return err
+		}
+		delays = frameDelays(len(frames), duration)
+	} else if animatedTextStyles[config.Style] && !config.RevealBg {
+		// neon and glitch animate on their own
+		background := frameBackgrounds(bgGen, bgParams, config, styledFrameCount)
+		for i := range styledFrameCount {
+			frames = append(frames, createFrame(background(i), config, renderer, lines, primaryFace, startY, lineHeight, "styled", i))
+		}
+	} else {
+		// Generate four frames with different effects
+		background := frameBackgrounds(bgGen, bgParams, config, 4)
+		frames = []*image.RGBA{
+			createFrame(background(0), config, renderer, lines, primaryFace, startY, lineHeight, "outline", 0),
+			createFrame(background(1), config, renderer, lines, primaryFace, startY, lineHeight, "reveal", 1),
+			createFrame(background(2), config, renderer, lines, primaryFace, startY, lineHeight, "plain", 2),
+			createFrame(background(3), config, renderer, lines, primaryFace, startY, lineHeight, "reveal-outline", 3),
+		}
+	}
+
+	if delays == nil {
+		// the classic frames keep their pace unless -duration spreads them
+		delays = slices.Repeat([]int{gifFrameDelay}, len(frames))
+		if config.Duration > 0 {
+			delays = frameDelays(len(frames), config.Duration)
+		}
+	}
+
+	for i, frame := range frames {
+		frames[i] = downsample(frame, outputConfig)
+	}
+	for i, mask := range crisp {
+		crisp[i] = downsample(mask, outputConfig)
 	}
 
-	// Create and save GIF
-	return saveAnimatedGIF(frames, text, config.OutputDir)
+	if config.CrispText && crisp == nil {
+		// the classic frames keep the text in place
+		mask := downsample(renderer.GlyphMask(canvas, lines, origins), outputConfig)
+		for range frames {
+			crisp = append(crisp, mask)
+		}
+	}
+
+	// Create and save the animation
+	return animationFormatMap[config.Format](frames, crisp, delays, outputConfig, bgParams.Palette, text)
 }
 
-// Fixed createFrame function
-func createFrame(bgGen BackgroundGenFunc, config Config, renderer *TextRenderer, lines []string, primaryFace font.Face, startY, lineHeight int, effect string) *image.RGBA {
-	img := bgGen(config.Width, config.Height)
+// frameBackgrounds returns the background of each of frames frames. With
+// -animate-bg it evolves over the loop, otherwise every frame gets a copy of
+// one background
+func frameBackgrounds(bgGen BackgroundGenFunc, bgParams BackgroundParams, config Config, frames int) func(frame int) *image.RGBA {
+	if !config.AnimateBackground {
+		background := bgGen(config.Width, config.Height, bgParams)
+		return func(int) *image.RGBA { return cloneImage(background) }
+	}
+	return func(frame int) *image.RGBA {
+		params := bgParams
+		params.Time = float64(frame) / float64(frames)
+		return bgGen(config.Width, config.Height, params)
+	}
+}
+
+// Fixed createFrame function, draws the text onto the frame's background
+func createFrame(img *image.RGBA, config Config, renderer *TextRenderer, lines []string, primaryFace font.Face, startY, lineHeight int, effect string, frame int) *image.RGBA {
+	origins := renderer.lineOrigins(lines, config.Width, startY, lineHeight)
 
 	switch effect {
 	case "outline":
 		// Center each line individually (like in static version)
-		for i, line := range lines {
-			width, _ := measureText(line, primaryFace)
-			lineX := max((config.Width-width)/2, 0)
-			y := startY + i*lineHeight
-			renderer.renderWithOutline(img, line, lineX, y, color.Black)
-			renderer.renderText(img, line, lineX, y, color.White)
-		}
+		renderer.RenderOutlined(img, lines, origins, frame)
 	case "reveal":
 		// For reveal effect, center the text properly
 		renderer.RenderRevealBackgroundCentered(img, lines, primaryFace, config.Width, startY, lineHeight, false)
 	case "plain":
 		// Center each line individually
-		for i, line := range lines {
-			width, _ := measureText(line, primaryFace)
-			lineX := max((config.Width-width)/2, 0)
-			y := startY + i*lineHeight
-			renderer.renderText(img, line, lineX, y, color.White)
-		}
+		renderer.RenderPlain(img, lines, origins, frame)
 	case "reveal-outline":
 		// For reveal effect with outline, center the text properly
 		renderer.RenderRevealBackgroundCentered(img, lines, primaryFace, config.Width, startY, lineHeight, true)
+	case "styled":
+		textStyleMap[config.Style](renderer, img, lines, origins, frame)
 	}
 
 	return img
 }
 
+// cloneImage returns a copy of img that can be drawn on independently
+func cloneImage(img *image.RGBA) *image.RGBA {
+	return &image.RGBA{Pix: slices.Clone(img.Pix), Stride: img.Stride, Rect: img.Rect}
+}
+
 func saveImage(img *image.RGBA, text, outputDir string) error {
 	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
 		return err
@@ -139,38 +334,102 @@ func saveImage(img *image.RGBA, text, outputDir string) error {
 	return nil
 }
 
-func saveAnimatedGIF(frames []*image.RGBA, text, outputDir string) error {
-	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+// AnimationWriter saves the frames of an animation, each shown for its delay
+// in hundredths of a second
+type AnimationWriter func(frames, crisp []*image.RGBA, delays []int, config Config, bgPalette []color.RGBA, text string) error
+
+// Animation format mapping
+var animationFormatMap = map[string]AnimationWriter{
+	"gif":  saveAnimatedGIF,
+	"apng": saveAPNG,
+	"webp": saveAnimatedWebP,
+}
+
+func getAnimationFormats() []string {
+	return getSortedKeys(animationFormatMap)
+}
+
+// gifLoopCount converts the times an animation plays to the GIF loop count,
+// which counts the repeats after the first play and uses -1 for none
+func gifLoopCount(loop int) int {
+	switch loop {
+	case 0:
+		return 0
+	case 1:
+		return -1
+	}
+	return loop - 1
+}
+
+// saveAnimatedGIF writes the frames, each shown for its delay in hundredths
+// of a second, in the configured playback order
+func saveAnimatedGIF(frames, crisp []*image.RGBA, delays []int, config Config, bgPalette []color.RGBA, text string) error {
+	if err := os.MkdirAll(config.OutputDir, os.ModePerm); err != nil {
 		return err
 	}
 
 	outGif := &gif.GIF{}
 
-	// Add frames to GIF in cycles
-	totalFrames := len(frames) * gifNumCylces
-	for i := range totalFrames {
-		frameIndex := i % len(frames)
-		imgRGBA := frames[frameIndex]
-
-		// Convert to paletted image
-		palettedImage := image.NewPaletted(imgRGBA.Bounds(), predefinedPalette)
-		draw.Draw(palettedImage, palettedImage.Rect, imgRGBA, image.Point{}, draw.Src)
+	// GIFs have on/off transparency through one reserved palette entry,
+	// which frame differencing also needs to mark unchanged pixels. Opaque
+	// frames that hardly repeat any pixels keep the entry for a color
+	transparent := !slices.ContainsFunc(frames, (*image.RGBA).Opaque)
+	keyed := transparent || config.OptimizeFrames && repeatsPixels(frames)
+	palettes := buildFramePalettes(frames, quantizerMap[config.Quantizer], config.Colors, config.FramePalettes, keyed, bgPalette)
+
+	// Convert frames to paletted images once, ping-pong playback reuses them
+	paletted := make([]*image.Paletted, len(frames))
+	for i, frame := range frames {
+		var mask *image.RGBA
+		if crisp != nil {
+			mask = crisp[i]
+		}
+		paletted[i] = palettedFrame(frame, palettes[i], keyed, ditherMap[config.Dither], mask)
+	}
+	order, delays := playbackOrder(delays, config)
+	outGif.LoopCount = gifLoopCount(config.Loop)
+	for i, frame := range order {
+		outGif.Image = append(outGif.Image, paletted[frame])
+		outGif.Delay = append(outGif.Delay, delays[i])
+		if transparent {
+			// clear each frame before the next so transparent areas don't
+			// show the previous one
+			outGif.Disposal = append(outGif.Disposal, gif.DisposalBackground)
+		}
+	}
 
-		outGif.Image = append(outGif.Image, palettedImage)
-		outGif.Delay = append(outGif.Delay, gifFrameDelay)
+	// pixels of the frames as -optimize=false stores them, whole canvases
+	fullPixels := len(outGif.Image) * config.Width * config.Height
+	if config.OptimizeFrames {
+		optimized := *outGif
+		optimized.Image, optimized.Disposal = optimizeFrames(outGif.Image)
+		if !config.FramePalettes {
+			// frames sharing the palette use it as the global color table
+			optimized.Config = image.Config{ColorModel: palettes[0], Width: config.Width, Height: config.Height}
+		}
+		outGif = &optimized
 	}
 
-	fileName := filepath.Join(outputDir, sanitizeFilename(text)+".gif")
+	fileName := filepath.Join(config.OutputDir, sanitizeFilename(text)+".gif")
 	f, err := os.Create(fileName)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	if err := gif.EncodeAll(f, outGif); err != nil {
+	var written byteCounter
+	if err := gif.EncodeAll(io.MultiWriter(f, &written), outGif); err != nil {
 		return err
 	}
 
 	fmt.Printf("✅ GIF animation successfully created: %s\n", fileName)
+	if config.OptimizeFrames {
+		stored := 0
+		for _, frame := range outGif.Image {
+			stored += frame.Rect.Dx() * frame.Rect.Dy()
+		}
+		fmt.Printf("📉 Frame differencing: %s, storing %.0f%% of the pixels of full frames\n",
+			formatBytes(int64(written)), 100*float64(stored)/float64(fullPixels))
+	}
 	return nil
 }
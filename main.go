@@ -12,6 +12,11 @@ import (
 func main() {
 	config := parseFlags()
 
+	if config.ListBackgrounds {
+		fmt.Print(describeBackgrounds())
+		return
+	}
+
 	if flag.NArg() < 1 {
 		printUsage()
 		os.Exit(1)
@@ -20,13 +25,13 @@ func main() {
 	text := flag.Arg(0)
 
 	// validate configuration
-	if err := validateConfig(config); err != nil {
+	if err := validateConfig(&config); err != nil {
 		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
 		os.Exit(1)
 	}
 
 	// generate output
-	if config.Animate {
+	if config.Animate || config.Timeline != "" {
 		if err := generateAnimatedGIF(text, config); err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to generate GIF: %v\n", err)
 			os.Exit(1)
@@ -47,16 +52,80 @@ func parseFlags() Config {
 		OutputDir:  "images",
 		Background: "default",
 		FontStyle:  "roboto_bold",
+
+		Palette:     "studio",
+		PaletteSize: 8,
+		Colors:      maxPaletteSize,
+		Quantizer:   "median-cut",
+		Dither:      "none",
+
+		Effect:         "classic",
+		FPS:            10,
+		Easing:         "ease-out",
+		OptimizeFrames: true,
+		Format:         "gif",
+
+		BackgroundFit:     "cover",
+		BackgroundOpacity: 1,
+
+		Supersample: 1,
+		BlendMode:   "normal",
+		Opacity:     1,
+
+		Style:        "outline",
+		NeonColor:    "#ff2bd6",
+		GlitchShift:  4,
+		GlitchSlices: 6,
+		Scanlines:    3,
 	}
 
 	flag.IntVar(&config.Width, "width", config.Width, "Image width in pixels")
 	flag.IntVar(&config.Height, "height", config.Height, "Image height in pixels")
 	flag.Float64Var(&config.FontSize, "font-size", config.FontSize, "Font size in points")
 	flag.StringVar(&config.OutputDir, "output", config.OutputDir, "Output directory")
-	flag.StringVar(&config.Background, "bg", config.Background, "Background pattern: "+strings.Join(getBackgroundTypes(), ", "))
+	flag.StringVar(&config.Background, "bg", config.Background, "Background pattern with optional parameters, e.g. diagonal:grid=20,angle=30. One of: "+strings.Join(getBackgroundTypes(), ", "))
 	flag.StringVar(&config.FontStyle, "font", config.FontStyle, "Font style: "+strings.Join(getFontStyles(), ", "))
 	flag.BoolVar(&config.RevealBg, "reveal-bg", false, "Display background via Text")
 	flag.BoolVar(&config.Animate, "animate", false, "Create animated GIF")
+	flag.StringVar(&config.Effect, "effect", config.Effect, "Animation effect of GIFs: "+strings.Join(getEffectNames(), ", "))
+	flag.StringVar(&config.Timeline, "timeline", "", "Render the GIF from a JSON or YAML keyframe timeline, implies -animate")
+	flag.BoolVar(&config.AnimateBackground, "animate-bg", false, "Evolve the background across GIF frames, looping seamlessly")
+	flag.Float64Var(&config.FPS, "fps", config.FPS, "Frames per second of effects and timelines, at most 50")
+	flag.Float64Var(&config.Duration, "duration", 0, "Length of the animation in seconds, 0 keeps the effect's natural length")
+	flag.IntVar(&config.Loop, "loop", 0, "Times the animation plays, 0 loops forever")
+	flag.IntVar(&config.FrameDelay, "frame-delay", 0, "Show every frame this many milliseconds, 0 keeps the animation's timing")
+	flag.Float64Var(&config.Hold, "hold", 0, "Seconds to hold the last frame before looping")
+	flag.BoolVar(&config.PingPong, "pingpong", false, "Play the frames forwards and then backwards")
+	flag.BoolVar(&config.OptimizeFrames, "optimize", config.OptimizeFrames, "Store only the changed part of each animation frame, GIFs whose frames repeat pixels give up one palette color for it")
+	flag.StringVar(&config.Format, "format", config.Format, "Output format: "+strings.Join(getAnimationFormats(), ", ")+" (webp also applies to still images)")
+	flag.StringVar(&config.Easing, "easing", config.Easing, "Curve of intro effects: "+strings.Join(getEasingNames(), ", ")+" or steps:N")
+	flag.IntVar(&config.Supersample, "supersample", config.Supersample, "Render at N times the resolution and downsample for smoother edges")
+	flag.StringVar(&config.BlendMode, "blend", config.BlendMode, "Text blend mode: "+strings.Join(getBlendModes(), ", "))
+	flag.Float64Var(&config.Opacity, "opacity", config.Opacity, "Text layer opacity between 0 and 1")
+	flag.StringVar(&config.Style, "style", config.Style, "Text style: "+strings.Join(getTextStyles(), ", "))
+	flag.Int64Var(&config.Seed, "seed", config.Seed, "Seed for noise backgrounds and randomized styles, same seed gives the same output")
+	flag.StringVar(&config.NeonColor, "neon-color", config.NeonColor, "Glow color of the neon style as hex")
+	flag.BoolVar(&config.Flicker, "flicker", false, "Flicker the neon glow across GIF frames")
+	flag.IntVar(&config.GlitchShift, "glitch-shift", config.GlitchShift, "RGB channel split of the glitch style in pixels")
+	flag.IntVar(&config.GlitchSlices, "glitch-slices", config.GlitchSlices, "Number of displaced slices in the glitch style")
+	flag.IntVar(&config.Scanlines, "scanlines", config.Scanlines, "Scanline spacing of the glitch style, 0 disables")
+	flag.StringVar(&config.Palette, "palette", config.Palette, "Palette for backgrounds and -quantizer=fixed GIFs, a file path or one of: "+strings.Join(getPaletteNames(), ", "))
+	flag.StringVar(&config.PaletteFrom, "palette-from", "", "Extract the palette from the dominant colors of this image, overrides -palette")
+	flag.IntVar(&config.PaletteSize, "palette-size", config.PaletteSize, "Number of colors extracted with -palette-from")
+	flag.IntVar(&config.Colors, "colors", config.Colors, "Number of colors in the GIF palette, at most 256")
+	flag.StringVar(&config.Quantizer, "quantizer", config.Quantizer, "How the GIF palette is built: "+strings.Join(getQuantizerNames(), ", "))
+	flag.BoolVar(&config.FramePalettes, "frame-palettes", false, "Give every GIF frame its own palette instead of one shared palette, truer colors but may flicker")
+	flag.StringVar(&config.Dither, "dither", config.Dither, "Dithering of GIF colors: "+strings.Join(getDitherNames(), ", "))
+	flag.BoolVar(&config.CrispText, "crisp-text", false, "Leave text glyphs undithered so letters stay crisp")
+	flag.StringVar(&config.BackgroundImage, "bg-image", "", "Use an image (PNG, JPEG, GIF, BMP, TIFF or WebP) as the background instead of -bg")
+	flag.StringVar(&config.BackgroundFit, "bg-fit", config.BackgroundFit, "How -bg-image fills the canvas: "+strings.Join(getImageFitModes(), ", "))
+	flag.Float64Var(&config.BackgroundAdjust.Blur, "bg-blur", 0, "Blur radius applied to -bg-image in pixels")
+	flag.Float64Var(&config.BackgroundAdjust.Darken, "bg-darken", 0, "Darken -bg-image by this amount between 0 and 1")
+	flag.Float64Var(&config.BackgroundAdjust.Desaturate, "bg-desaturate", 0, "Desaturate -bg-image by this amount between 0 and 1")
+	flag.Float64Var(&config.BackgroundOpacity, "bg-opacity", config.BackgroundOpacity, "Background opacity between 0 and 1, PNGs and GIFs keep the transparency")
+	flag.BoolVar(&config.Tileable, "tileable", false, "Make the background wrap seamlessly at its edges for use as a tile")
+	flag.BoolVar(&config.CheckSeams, "check-seams", false, "Report how well the background edges match and fail when they don't")
+	flag.BoolVar(&config.ListBackgrounds, "list-bg", false, "List background patterns and their parameters")
 
 	flag.Usage = printUsage
 	flag.Parse()
@@ -73,4 +142,9 @@ func printUsage() {
 	fmt.Println("  cli_tool \"Hello World\"")
 	fmt.Println("  cli_tool -width=800 -height=400 -font=roboto_bold \"Custom Text\"")
 	fmt.Println("  cli_tool -animate -bg=perlin \"Animated Text\"")
+	fmt.Println("  cli_tool -animate -style=neon -flicker \"Neon Sign\"")
+	fmt.Println("  cli_tool -animate -effect=typewriter \"Typed Out\"")
+	fmt.Println("  cli_tool -timeline=examples/timeline.json \"Keyframed\"")
+	fmt.Println("  cli_tool -bg=diagonal:grid=20,angle=30 \"Stripes\"")
+	fmt.Println("  cli_tool -bg-image=photo.jpg -bg-blur=4 -bg-darken=0.3 \"On A Photo\"")
 }
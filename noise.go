@@ -0,0 +1,176 @@
+// seeded gradient noise (Perlin, OpenSimplex2) and fractal Brownian motion
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// NoiseFunc returns gradient noise in roughly [-1, 1] for a point
+type NoiseFunc func(x, y float64) float64
+
+// NoiseOptions controls fractal Brownian motion layering
+type NoiseOptions struct {
+	Scale       float64 // size of the largest features in logical pixels
+	Octaves     int     // number of noise layers
+	Lacunarity  float64 // frequency multiplier between octaves
+	Persistence float64 // amplitude multiplier between octaves
+}
+
+// fbm sums octaves of noise and normalizes the result back to [-1, 1]
+func fbm(noise NoiseFunc, x, y float64, opts NoiseOptions) float64 {
+	sum, norm := 0.0, 0.0
+	amplitude, frequency := 1.0, 1.0
+	for octave := range opts.Octaves {
+		// offset each octave so their lattices don't line up at the origin
+		shift := float64(octave) * 17.31
+		sum += amplitude * noise(x*frequency+shift, y*frequency+shift)
+		norm += amplitude
+		amplitude *= opts.Persistence
+		frequency *= opts.Lacunarity
+	}
+	return sum / norm
+}
+
+// Perlin's improved noise with a seeded permutation table
+type perlinNoise struct {
+	perm [512]uint8
+}
+
+func newPerlinNoise(seed int64) *perlinNoise {
+	p := &perlinNoise{}
+	rng := rand.New(rand.NewPCG(uint64(seed), 0x9e3779b97f4a7c15))
+	for i, v := range rng.Perm(256) {
+		p.perm[i] = uint8(v)
+		p.perm[i+256] = uint8(v)
+	}
+	return p
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + t*(b-a)
+}
+
+// perlinGrad dots the offset with one of eight lattice gradients
+func perlinGrad(hash uint8, x, y float64) float64 {
+	switch hash & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x * math.Sqrt2
+	case 5:
+		return -x * math.Sqrt2
+	case 6:
+		return y * math.Sqrt2
+	default:
+		return -y * math.Sqrt2
+	}
+}
+
+func (p *perlinNoise) noise(x, y float64) float64 {
+	fx, fy := math.Floor(x), math.Floor(y)
+	xi, yi := int(fx)&255, int(fy)&255
+	x, y = x-fx, y-fy
+	u, v := fade(x), fade(y)
+
+	aa := p.perm[int(p.perm[xi])+yi]
+	ab := p.perm[int(p.perm[xi])+yi+1]
+	ba := p.perm[int(p.perm[xi+1])+yi]
+	bb := p.perm[int(p.perm[xi+1])+yi+1]
+
+	return lerp(
+		lerp(perlinGrad(aa, x, y), perlinGrad(ba, x-1, y), u),
+		lerp(perlinGrad(ab, x, y-1), perlinGrad(bb, x-1, y-1), u),
+		v,
+	)
+}
+
+// OpenSimplex2 noise after KdotJPG's public domain reference implementation
+const (
+	simplexPrimeX     = 0x5205402B9270C86F
+	simplexPrimeY     = 0x598CD327003817B5
+	simplexHashMul    = 0x53A3F72DEEC546F5
+	simplexSkew       = 0.366025403784439
+	simplexUnskew     = -0.21132486540518713
+	simplexGradExp    = 7
+	simplexGradCount  = 1 << simplexGradExp
+	simplexRSquared   = 0.5
+	simplexNormalizer = 0.01001634121365712
+)
+
+var simplexGradients [simplexGradCount * 2]float64
+
+func init() {
+	// 24 unit gradients spread around the circle
+	const directions = 24
+	for i := range simplexGradCount {
+		angle := (float64(i%directions) + 0.5) * 2 * math.Pi / directions
+		simplexGradients[i*2] = math.Cos(angle) / simplexNormalizer
+		simplexGradients[i*2+1] = math.Sin(angle) / simplexNormalizer
+	}
+}
+
+type simplexNoise struct {
+	seed int64
+}
+
+func newSimplexNoise(seed int64) *simplexNoise {
+	return &simplexNoise{seed: seed}
+}
+
+func (s *simplexNoise) grad(xsvp, ysvp int64, dx, dy float64) float64 {
+	hash := s.seed ^ xsvp ^ ysvp
+	hash *= simplexHashMul
+	hash ^= hash >> (64 - simplexGradExp + 1)
+	gi := int(hash) & ((simplexGradCount - 1) << 1)
+	return simplexGradients[gi]*dx + simplexGradients[gi|1]*dy
+}
+
+func (s *simplexNoise) noise(x, y float64) float64 {
+	skew := simplexSkew * (x + y)
+	xs, ys := x+skew, y+skew
+
+	xsb, ysb := math.Floor(xs), math.Floor(ys)
+	xi, yi := xs-xsb, ys-ysb
+	xsbp, ysbp := int64(xsb)*simplexPrimeX, int64(ysb)*simplexPrimeY
+
+	t := (xi + yi) * simplexUnskew
+	dx0, dy0 := xi+t, yi+t
+
+	value := 0.0
+	a0 := simplexRSquared - dx0*dx0 - dy0*dy0
+	if a0 > 0 {
+		value = a0 * a0 * a0 * a0 * s.grad(xsbp, ysbp, dx0, dy0)
+	}
+
+	const u = 1 + 2*simplexUnskew
+	a1 := (2*u*(1/simplexUnskew+2))*t + (-2*u*u + a0)
+	if a1 > 0 {
+		dx1, dy1 := dx0-u, dy0-u
+		value += a1 * a1 * a1 * a1 * s.grad(xsbp+simplexPrimeX, ysbp+simplexPrimeY, dx1, dy1)
+	}
+
+	if dy0 > dx0 {
+		dx2, dy2 := dx0-simplexUnskew, dy0-(simplexUnskew+1)
+		if a2 := simplexRSquared - dx2*dx2 - dy2*dy2; a2 > 0 {
+			value += a2 * a2 * a2 * a2 * s.grad(xsbp, ysbp+simplexPrimeY, dx2, dy2)
+		}
+	} else {
+		dx2, dy2 := dx0-(simplexUnskew+1), dy0-simplexUnskew
+		if a2 := simplexRSquared - dx2*dx2 - dy2*dy2; a2 > 0 {
+			value += a2 * a2 * a2 * a2 * s.grad(xsbp+simplexPrimeX, ysbp, dx2, dy2)
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,291 @@
+// built-in color palettes and palette file loading
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Palette mapping - colors run from dark to light where it makes sense so
+// noise generators get a smooth ramp
+var paletteMap = map[string][]color.RGBA{
+	"studio":     studioPalette,
+	"sunset":     mustParseColors("2d1b4e/5b2a6e/8e3b73/c44d6e/e8705e/f59f5b/f9c96b/fde9a8"),
+	"ocean":      mustParseColors("03045e/023e8a/0077b6/0096c7/00b4d8/48cae4/90e0ef/caf0f8"),
+	"monochrome": mustParseColors("111111/333333/555555/777777/999999/bbbbbb/dddddd/f5f5f5"),
+	"pastel":     mustParseColors("ffd1dc/ffe5b4/fffacd/d4f0c0/c1e7e3/c9d7f8/dcc6f0/f8d7e8"),
+	"cyberpunk":  mustParseColors("0d0221/241734/2e2157/541388/d90368/ff2a6d/f9c80e/05d9e8"),
+}
+
+const minPaletteColors = 2
+
+func mustParseColors(list string) []color.RGBA {
+	colors, err := parseColorList(list)
+	if err != nil {
+		panic(err)
+	}
+	return colors
+}
+
+func getPaletteNames() []string {
+	return getSortedKeys(paletteMap)
+}
+
+// loadPalette resolves a -palette value, either a built-in name or the path
+// of a hex list, GIMP .gpl or Adobe .ase file
+func loadPalette(nameOrPath string) ([]color.RGBA, error) {
+	if palette, exists := paletteMap[nameOrPath]; exists {
+		return palette, nil
+	}
+
+	data, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		return nil, fmt.Errorf("palette %q is neither a built-in palette nor a readable file: %v", nameOrPath, err)
+	}
+
+	var palette []color.RGBA
+	switch strings.ToLower(filepath.Ext(nameOrPath)) {
+	case ".gpl":
+		palette, err = parseGIMPPalette(data)
+	case ".ase":
+		palette, err = parseASEPalette(data)
+	default:
+		palette, err = parseHexPalette(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load palette %s: %v", nameOrPath, err)
+	}
+	if len(palette) < minPaletteColors {
+		return nil, fmt.Errorf("palette %s needs at least %d colors", nameOrPath, minPaletteColors)
+	}
+	return palette, nil
+}
+
+// resolvePalette picks the palette for a render, colors extracted with
+// -palette-from take precedence over -palette
+func resolvePalette(config Config) ([]color.RGBA, error) {
+	if config.PaletteFrom == "" {
+		return loadPalette(config.Palette)
+	}
+	img, err := loadImageFile(config.PaletteFrom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read palette image: %v", err)
+	}
+	palette := extractPalette(img, config.PaletteSize, config.Seed)
+	if len(palette) == 0 {
+		return nil, errors.New("no opaque pixels to extract a palette from in " + config.PaletteFrom)
+	}
+	if len(palette) < minPaletteColors {
+		return nil, fmt.Errorf("palette image %s needs at least %d distinct colors", config.PaletteFrom, minPaletteColors)
+	}
+	return palette, nil
+}
+
+// parseHexPalette reads hex colors separated by whitespace, commas or
+// newlines. Lines starting with ";" or "//" are comments
+func parseHexPalette(data []byte) ([]color.RGBA, error) {
+	var palette []color.RGBA
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		for _, field := range fields {
+			c, err := parseHexColor(field)
+			if err != nil {
+				return nil, err
+			}
+			palette = append(palette, c)
+		}
+	}
+	return palette, scanner.Err()
+}
+
+// parseGIMPPalette reads the "R G B name" rows of a GIMP palette
+func parseGIMPPalette(data []byte) ([]color.RGBA, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "GIMP Palette" {
+		return nil, errors.New("missing GIMP Palette header")
+	}
+
+	var palette []color.RGBA
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") ||
+			strings.HasPrefix(line, "Name:") || strings.HasPrefix(line, "Columns:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, errors.New("invalid palette row: " + line)
+		}
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.ParseUint(fields[i], 10, 8)
+			if err != nil {
+				return nil, errors.New("invalid palette row: " + line)
+			}
+			rgb[i] = uint8(v)
+		}
+		palette = append(palette, color.RGBA{rgb[0], rgb[1], rgb[2], 255})
+	}
+	return palette, scanner.Err()
+}
+
+// Adobe Swatch Exchange block types
+const (
+	aseColorEntry = 0x0001
+	aseGroupStart = 0xc001
+	aseGroupEnd   = 0xc002
+)
+
+// parseASEPalette reads the color entries of an Adobe Swatch Exchange file,
+// skipping group markers
+func parseASEPalette(data []byte) ([]color.RGBA, error) {
+	r := bytes.NewReader(data)
+	var header struct {
+		Signature [4]byte
+		Major     uint16
+		Minor     uint16
+		Blocks    uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil || string(header.Signature[:]) != "ASEF" {
+		return nil, errors.New("not an ASE file")
+	}
+
+	var palette []color.RGBA
+	for range header.Blocks {
+		var blockType uint16
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &blockType); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		// the length comes from the file, check it before allocating
+		if int64(length) > int64(r.Len()) {
+			return nil, fmt.Errorf("ASE block of %d bytes is longer than the rest of the file", length)
+		}
+		block := make([]byte, length)
+		if _, err := io.ReadFull(r, block); err != nil {
+			return nil, err
+		}
+		if blockType != aseColorEntry {
+			continue
+		}
+		c, err := parseASEColor(block)
+		if err != nil {
+			return nil, err
+		}
+		palette = append(palette, c)
+	}
+	return palette, nil
+}
+
+func parseASEColor(block []byte) (color.RGBA, error) {
+	br := bytes.NewReader(block)
+	var nameLen uint16
+	if err := binary.Read(br, binary.BigEndian, &nameLen); err != nil {
+		return color.RGBA{}, err
+	}
+	// the UTF-16 swatch name is only used in error messages
+	name := make([]uint16, nameLen)
+	if err := binary.Read(br, binary.BigEndian, name); err != nil {
+		return color.RGBA{}, err
+	}
+
+	var model [4]byte
+	if err := binary.Read(br, binary.BigEndian, &model); err != nil {
+		return color.RGBA{}, err
+	}
+	channels := map[string]int{"RGB ": 3, "CMYK": 4, "LAB ": 3, "Gray": 1}[string(model[:])]
+	if channels == 0 {
+		return color.RGBA{}, fmt.Errorf("unsupported color model %q in swatch %s",
+			string(model[:]), strings.TrimRight(string(utf16.Decode(name)), "\x00"))
+	}
+	values := make([]float32, channels)
+	if err := binary.Read(br, binary.BigEndian, values); err != nil {
+		return color.RGBA{}, err
+	}
+
+	to8 := func(v float64) uint8 { return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255)) }
+	switch string(model[:]) {
+	case "RGB ":
+		return color.RGBA{to8(float64(values[0])), to8(float64(values[1])), to8(float64(values[2])), 255}, nil
+	case "CMYK":
+		k := 1 - float64(values[3])
+		return color.RGBA{
+			to8((1 - float64(values[0])) * k),
+			to8((1 - float64(values[1])) * k),
+			to8((1 - float64(values[2])) * k),
+			255,
+		}, nil
+	case "Gray":
+		g := to8(float64(values[0]))
+		return color.RGBA{g, g, g, 255}, nil
+	default:
+		return labToRGBA(float64(values[0])*100, float64(values[1]), float64(values[2])), nil
+	}
+}
+
+// labToRGBA converts CIELAB (D50, as used by ASE) to sRGB
+func labToRGBA(l, a, b float64) color.RGBA {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+	inv := func(t float64) float64 {
+		if t*t*t > 216.0/24389 {
+			return t * t * t
+		}
+		return (116*t - 16) / (24389.0 / 27)
+	}
+	// D50 white point
+	x, y, z := 0.9642*inv(fx), inv(fy), 0.8251*inv(fz)
+
+	// Bradford adapted D50 XYZ to linear sRGB
+	rl := 3.1338561*x - 1.6168667*y - 0.4906146*z
+	gl := -0.9787684*x + 1.9161415*y + 0.0334540*z
+	bl := 0.0719453*x - 0.2289914*y + 1.4052427*z
+
+	return color.RGBA{linearToSRGB8(rl), linearToSRGB8(gl), linearToSRGB8(bl), 255}
+}
+
+// linearToSRGB8 applies the sRGB transfer curve and quantizes to 8 bits
+func linearToSRGB8(v float64) uint8 {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return uint8(math.Round(v * 255))
+}
+
+// buildGIFPalette returns black, white and the background palette, capped
+// at the GIF color limit
+func buildGIFPalette(palette []color.RGBA) color.Palette {
+	gifPalette := color.Palette{color.Black, color.White}
+	for _, c := range palette {
+		if len(gifPalette) >= maxPaletteSize {
+			break
+		}
+		gifPalette = append(gifPalette, c)
+	}
+	return gifPalette
+}
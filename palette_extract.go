@@ -0,0 +1,128 @@
+// dominant color extraction from reference images
+package main
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"slices"
+)
+
+const (
+	// pixels sampled from the reference image, enough for stable clusters
+	extractSampleSize = 40000
+	kmeansIterations  = 30
+)
+
+// extractPalette finds the n dominant colors of img with k-means in OKLab
+// and returns them ordered from dark to light
+func extractPalette(img image.Image, n int, seed int64) []color.RGBA {
+	samples := samplePixels(img, extractSampleSize)
+	if len(samples) == 0 {
+		return nil
+	}
+	n = min(n, len(samples))
+	rng := rand.New(rand.NewPCG(uint64(seed), 0x5bd1e995))
+
+	centers := kmeansPlusPlus(samples, n, rng)
+	assignments := make([]int, len(samples))
+
+	for range kmeansIterations {
+		changed := false
+		for i, s := range samples {
+			best := nearestCenter(s, centers)
+			if best != assignments[i] {
+				assignments[i] = best
+				changed = true
+			}
+		}
+
+		sums := make([]OKLab, len(centers))
+		counts := make([]int, len(centers))
+		for i, s := range samples {
+			c := assignments[i]
+			sums[c].L += s.L
+			sums[c].A += s.A
+			sums[c].B += s.B
+			counts[c]++
+		}
+		for c := range centers {
+			// empty clusters keep their previous center
+			if counts[c] > 0 {
+				k := float64(counts[c])
+				centers[c] = OKLab{sums[c].L / k, sums[c].A / k, sums[c].B / k}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	slices.SortFunc(centers, func(a, b OKLab) int { return cmp.Compare(a.L, b.L) })
+	palette := make([]color.RGBA, len(centers))
+	for i, c := range centers {
+		palette[i] = c.toRGBA()
+	}
+	return palette
+}
+
+// samplePixels converts an evenly spaced subset of opaque pixels to OKLab
+func samplePixels(img image.Image, maxSamples int) []OKLab {
+	b := img.Bounds()
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > maxSamples {
+		step++
+	}
+
+	var samples []OKLab
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				continue
+			}
+			samples = append(samples, rgbaToOKLab(color.RGBA{c.R, c.G, c.B, 255}))
+		}
+	}
+	return samples
+}
+
+// kmeansPlusPlus spreads the initial centers apart, picking each new one
+// with probability proportional to its squared distance from the others
+func kmeansPlusPlus(samples []OKLab, k int, rng *rand.Rand) []OKLab {
+	centers := []OKLab{samples[rng.IntN(len(samples))]}
+	dist := make([]float64, len(samples))
+
+	for len(centers) < k {
+		total := 0.0
+		for i, s := range samples {
+			dist[i] = s.distanceSq(centers[nearestCenter(s, centers)])
+			total += dist[i]
+		}
+		if total == 0 {
+			// fewer distinct colors than requested
+			break
+		}
+		target := rng.Float64() * total
+		pick := len(samples) - 1
+		for i, d := range dist {
+			if target -= d; target <= 0 {
+				pick = i
+				break
+			}
+		}
+		centers = append(centers, samples[pick])
+	}
+	return centers
+}
+
+func nearestCenter(s OKLab, centers []OKLab) int {
+	best, bestDist := 0, s.distanceSq(centers[0])
+	for i := 1; i < len(centers); i++ {
+		if d := s.distanceSq(centers[i]); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
@@ -0,0 +1,55 @@
+// parallel row processing and direct pixel writes for the generators
+package main
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelRows calls fn once for every row in [0, h). Workers take the next
+// free row, so expensive areas like a fractal's interior don't leave the
+// other workers idle. fn must be safe to call concurrently
+func parallelRows(h int, fn func(y int)) {
+	workers := min(runtime.GOMAXPROCS(0), h)
+	if workers <= 1 {
+		for y := range h {
+			fn(y)
+		}
+		return
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				y := int(next.Add(1) - 1)
+				if y >= h {
+					return
+				}
+				fn(y)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// fillPixels sets every pixel to the color returned by pixel, writing
+// straight into img.Pix with the rows spread across workers. Coordinates
+// are relative to the image origin
+func fillPixels(img *image.RGBA, pixel func(x, y int) color.RGBA) {
+	w := img.Rect.Dx()
+	parallelRows(img.Rect.Dy(), func(y int) {
+		i := img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y)
+		row := img.Pix[i : i+w*4 : i+w*4]
+		for x := range w {
+			c := pixel(x, y)
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = c.R, c.G, c.B, c.A
+		}
+	})
+}
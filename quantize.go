@@ -0,0 +1,459 @@
+// adaptive palette quantization for GIF frames
+package main
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"sync/atomic"
+)
+
+const (
+	// pixels looked at when building a palette, spread evenly over the frames
+	maxQuantizeSamples = 1 << 20
+	// octree levels, the low bits of each channel only feed the averages
+	octreeDepth = 6
+)
+
+// QuantizerFunc reduces a color histogram to at most n colors, base is the
+// background palette for quantizers that don't adapt to the pixels
+type QuantizerFunc func(hist []colorCount, n int, base []color.RGBA) color.Palette
+
+// Quantizer mapping
+var quantizerMap = map[string]QuantizerFunc{
+	"median-cut": medianCut,
+	"octree":     octreeQuantize,
+	"fixed":      fixedQuantize,
+}
+
+func getQuantizerNames() []string {
+	return getSortedKeys(quantizerMap)
+}
+
+// colorCount is an opaque color and how many sampled pixels have it
+type colorCount struct {
+	c     color.RGBA
+	count int
+}
+
+func packRGB(c color.RGBA) uint32 {
+	return uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
+// unpremultiplied returns the straight color of the pixel at Pix offset i,
+// GIF colors are always fully opaque
+func unpremultiplied(img *image.RGBA, i int) color.RGBA {
+	a := int(img.Pix[i+3])
+	if a == 255 || a == 0 {
+		return color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], 255}
+	}
+	unmul := func(v uint8) uint8 { return uint8(int(v) * 255 / a) }
+	return color.RGBA{unmul(img.Pix[i]), unmul(img.Pix[i+1]), unmul(img.Pix[i+2]), 255}
+}
+
+// colorHistogram counts the colors of an evenly spaced subset of the
+// visible pixels, sorted so the quantizers don't depend on map order
+func colorHistogram(frames []*image.RGBA) []colorCount {
+	total := 0
+	for _, img := range frames {
+		total += img.Rect.Dx() * img.Rect.Dy()
+	}
+	step := max(1, total/maxQuantizeSamples)
+
+	counts := make(map[uint32]int)
+	n := 0
+	for _, img := range frames {
+		for y := range img.Rect.Dy() {
+			for x := range img.Rect.Dx() {
+				if n++; n%step != 0 {
+					continue
+				}
+				i := img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+				if img.Pix[i+3] < 128 {
+					continue
+				}
+				counts[packRGB(unpremultiplied(img, i))]++
+			}
+		}
+	}
+
+	hist := make([]colorCount, 0, len(counts))
+	for key, count := range counts {
+		c := color.RGBA{uint8(key >> 16), uint8(key >> 8), uint8(key), 255}
+		hist = append(hist, colorCount{c, count})
+	}
+	slices.SortFunc(hist, func(a, b colorCount) int { return cmp.Compare(packRGB(a.c), packRGB(b.c)) })
+	return hist
+}
+
+// channel returns the red, green or blue component for axis 0, 1 or 2
+func channel(c color.RGBA, axis int) uint8 {
+	switch axis {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+// medianCut splits the color box with the most pixels times extent along its
+// longest axis at the median pixel until there are n boxes, each becoming
+// the average of its colors
+func medianCut(hist []colorCount, n int, _ []color.RGBA) color.Palette {
+	if len(hist) == 0 {
+		return color.Palette{color.Black}
+	}
+
+	type box struct {
+		colors []colorCount
+		count  int
+		axis   int
+		extent int
+	}
+	newBox := func(colors []colorCount) box {
+		b := box{colors: colors}
+		lo, hi := [3]int{255, 255, 255}, [3]int{}
+		for _, cc := range colors {
+			b.count += cc.count
+			for axis := range 3 {
+				v := int(channel(cc.c, axis))
+				lo[axis], hi[axis] = min(lo[axis], v), max(hi[axis], v)
+			}
+		}
+		for axis := range 3 {
+			if hi[axis]-lo[axis] > b.extent {
+				b.axis, b.extent = axis, hi[axis]-lo[axis]
+			}
+		}
+		return b
+	}
+
+	boxes := []box{newBox(hist)}
+	for len(boxes) < n {
+		// pick the box whose colors are both common and spread out
+		pick, best := -1, 0
+		for i, b := range boxes {
+			if score := b.count * b.extent; len(b.colors) > 1 && score > best {
+				pick, best = i, score
+			}
+		}
+		if pick < 0 {
+			// every remaining box holds a single color
+			break
+		}
+
+		b := boxes[pick]
+		slices.SortStableFunc(b.colors, func(x, y colorCount) int {
+			return cmp.Compare(channel(x.c, b.axis), channel(y.c, b.axis))
+		})
+		// split where half of the pixels fall on either side, keeping both
+		// halves non-empty
+		split, seen := 1, 0
+		for i, cc := range b.colors[:len(b.colors)-1] {
+			seen += cc.count
+			split = i + 1
+			if seen*2 >= b.count {
+				break
+			}
+		}
+		boxes[pick] = newBox(b.colors[:split])
+		boxes = append(boxes, newBox(b.colors[split:]))
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		var r, g, bl int
+		for _, cc := range b.colors {
+			r += int(cc.c.R) * cc.count
+			g += int(cc.c.G) * cc.count
+			bl += int(cc.c.B) * cc.count
+		}
+		palette[i] = color.RGBA{uint8(r / b.count), uint8(g / b.count), uint8(bl / b.count), 255}
+	}
+	return palette
+}
+
+// octreeNode sums the colors of every pixel below it
+type octreeNode struct {
+	r, g, b, count int
+	children       [8]*octreeNode
+	leaf           bool
+}
+
+// octreeQuantize sorts the colors into an octree on their leading bits and
+// folds the least used branches, deepest first, until n leaves remain
+func octreeQuantize(hist []colorCount, n int, _ []color.RGBA) color.Palette {
+	if len(hist) == 0 {
+		return color.Palette{color.Black}
+	}
+
+	root := &octreeNode{}
+	// inner nodes by level, the candidates for folding
+	var levels [octreeDepth][]*octreeNode
+	levels[0] = []*octreeNode{root}
+	leaves := 0
+
+	for _, cc := range hist {
+		node := root
+		for level := 0; ; level++ {
+			node.r += int(cc.c.R) * cc.count
+			node.g += int(cc.c.G) * cc.count
+			node.b += int(cc.c.B) * cc.count
+			node.count += cc.count
+			if node.leaf {
+				break
+			}
+			shift := 7 - level
+			i := int(cc.c.R>>shift&1)<<2 | int(cc.c.G>>shift&1)<<1 | int(cc.c.B>>shift&1)
+			if node.children[i] == nil {
+				child := &octreeNode{leaf: level == octreeDepth-1}
+				if child.leaf {
+					leaves++
+				} else {
+					levels[level+1] = append(levels[level+1], child)
+				}
+				node.children[i] = child
+			}
+			node = node.children[i]
+		}
+	}
+
+	// the deepest inner nodes only have leaves below them, so folding one
+	// into a leaf keeps its pixels' average without revisiting them. Folding
+	// leaves the sums alone, so each level is sorted once, least used first
+	for level := octreeDepth - 1; level >= 0 && leaves > n; level-- {
+		nodes := levels[level]
+		slices.SortStableFunc(nodes, func(a, b *octreeNode) int { return cmp.Compare(a.count, b.count) })
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			for i, child := range node.children {
+				if child != nil {
+					leaves--
+					node.children[i] = nil
+				}
+			}
+			node.leaf = true
+			leaves++
+		}
+	}
+
+	var palette color.Palette
+	var collect func(node *octreeNode)
+	collect = func(node *octreeNode) {
+		if node.leaf {
+			palette = append(palette, color.RGBA{
+				uint8(node.r / node.count), uint8(node.g / node.count), uint8(node.b / node.count), 255})
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				collect(child)
+			}
+		}
+	}
+	collect(root)
+	return palette
+}
+
+// fixedQuantize ignores the pixels and uses black, white and the background
+// palette, the original GIF behaviour
+func fixedQuantize(_ []colorCount, n int, base []color.RGBA) color.Palette {
+	palette := buildGIFPalette(base)
+	return palette[:min(len(palette), n)]
+}
+
+// buildFramePalettes returns the palette of every frame, one shared by all
+// of them unless perFrame is set. Transparent animations reserve the last
+// entry for the transparent color
+func buildFramePalettes(frames []*image.RGBA, quantizer QuantizerFunc, colors int, perFrame, transparent bool, base []color.RGBA) []color.Palette {
+	if transparent {
+		colors--
+	}
+	build := func(frames []*image.RGBA) color.Palette {
+		palette := quantizer(colorHistogram(frames), colors, base)
+		if transparent {
+			palette = append(palette, color.Transparent)
+		}
+		return palette
+	}
+
+	palettes := make([]color.Palette, len(frames))
+	if perFrame {
+		for i, frame := range frames {
+			palettes[i] = build([]*image.RGBA{frame})
+		}
+		return palettes
+	}
+	// one palette keeps colors from shifting between frames
+	palette := build(frames)
+	for i := range palettes {
+		palettes[i] = palette
+	}
+	return palettes
+}
+
+// paletteLookup finds the nearest palette color by comparing only the
+// colors that can be nearest somewhere in each cell of the RGB cube. Cells
+// are filled in on first use, most images only touch a few of them
+type paletteLookup struct {
+	colors []color.RGBA
+	cells  []atomic.Pointer[[]uint8]
+}
+
+// cells span lookupCellSize values of each channel
+const (
+	lookupCellBits = 3
+	lookupCellSize = 1 << lookupCellBits
+	lookupCells    = 256 / lookupCellSize
+)
+
+func newPaletteLookup(palette color.Palette) *paletteLookup {
+	lookup := &paletteLookup{
+		colors: make([]color.RGBA, len(palette)),
+		cells:  make([]atomic.Pointer[[]uint8], lookupCells*lookupCells*lookupCells),
+	}
+	for i, c := range palette {
+		lookup.colors[i] = color.RGBAModel.Convert(c).(color.RGBA)
+	}
+	return lookup
+}
+
+// candidates returns the colors that can be nearest within the cell at
+// r, g, b. Workers racing on a new cell compute the same list
+func (l *paletteLookup) candidates(r, g, b int) []uint8 {
+	cell := &l.cells[(r*lookupCells+g)*lookupCells+b]
+	if list := cell.Load(); list != nil {
+		return *list
+	}
+
+	// a color is nearest somewhere in the cell only if it is within the
+	// cell diameter of the color nearest the cell center
+	half := float64(lookupCellSize-1) / 2
+	diameter := 2 * math.Sqrt(3) * half
+	center := [3]float64{
+		float64(r*lookupCellSize) + half,
+		float64(g*lookupCellSize) + half,
+		float64(b*lookupCellSize) + half,
+	}
+	dist := make([]float64, len(l.colors))
+	nearest := math.Inf(1)
+	for i, c := range l.colors {
+		dr, dg, db := float64(c.R)-center[0], float64(c.G)-center[1], float64(c.B)-center[2]
+		dist[i] = math.Sqrt(dr*dr + dg*dg + db*db)
+		nearest = min(nearest, dist[i])
+	}
+	var list []uint8
+	for i, d := range dist {
+		if d <= nearest+diameter {
+			list = append(list, uint8(i))
+		}
+	}
+	cell.Store(&list)
+	return list
+}
+
+// nearest returns the index of the palette color closest to r, g, b, which
+// are clamped to the channel range
+func (l *paletteLookup) nearest(r, g, b int) uint8 {
+	r, g, b = max(0, min(255, r)), max(0, min(255, g)), max(0, min(255, b))
+	candidates := l.candidates(r>>lookupCellBits, g>>lookupCellBits, b>>lookupCellBits)
+	best, bestDist := candidates[0], math.MaxInt
+	for _, i := range candidates {
+		c := l.colors[i]
+		dr, dg, db := int(c.R)-r, int(c.G)-g, int(c.B)-b
+		if d := dr*dr + dg*dg + db*db; d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// palettedFrame maps every pixel to a palette color, dithered unless the
+// crisp mask covers it. With transparent set, mostly transparent pixels take
+// the last entry
+func palettedFrame(img *image.RGBA, palette color.Palette, transparent bool, dither DitherSpec, crisp *image.RGBA) *image.Paletted {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dst := image.NewPaletted(image.Rect(0, 0, w, h), palette)
+	opaque := palette
+	if transparent {
+		opaque = palette[:len(palette)-1]
+	}
+	transparentIndex := uint8(len(palette) - 1)
+	lookup := newPaletteLookup(opaque)
+
+	// pixel returns the straight color at x, y, or false when it is left
+	// transparent
+	pixel := func(x, y int) (color.RGBA, bool) {
+		i := img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+		if transparent && img.Pix[i+3] < 128 {
+			return color.RGBA{}, false
+		}
+		return unpremultiplied(img, i), true
+	}
+	dithered := func(x, y int) bool {
+		return crisp == nil || crisp.Pix[crisp.PixOffset(crisp.Rect.Min.X+x, crisp.Rect.Min.Y+y)+3] == 0
+	}
+
+	if dither.Kernel != nil {
+		// error diffusion depends on the pixels before, so it runs in order
+		errs := make([][3]float64, w*h)
+		for y := range h {
+			for x := range w {
+				c, visible := pixel(x, y)
+				if !visible {
+					dst.Pix[y*dst.Stride+x] = transparentIndex
+					continue
+				}
+				if !dithered(x, y) {
+					dst.Pix[y*dst.Stride+x] = lookup.nearest(int(c.R), int(c.G), int(c.B))
+					continue
+				}
+				e := errs[y*w+x]
+				want := [3]float64{float64(c.R) + e[0], float64(c.G) + e[1], float64(c.B) + e[2]}
+				index := lookup.nearest(int(math.Round(want[0])), int(math.Round(want[1])), int(math.Round(want[2])))
+				dst.Pix[y*dst.Stride+x] = index
+
+				got := lookup.colors[index]
+				diff := [3]float64{want[0] - float64(got.R), want[1] - float64(got.G), want[2] - float64(got.B)}
+				for _, k := range dither.Kernel {
+					nx, ny := x+k.dx, y+k.dy
+					if nx < 0 || nx >= w || ny >= h {
+						continue
+					}
+					for c := range 3 {
+						errs[ny*w+nx][c] += diff[c] * k.weight
+					}
+				}
+			}
+		}
+		return dst
+	}
+
+	var matrix [][]float64
+	spread := 0.0
+	if dither.Bayer > 0 {
+		matrix = bayerMatrix(dither.Bayer)
+		spread = ditherSpread(len(opaque))
+	}
+	parallelRows(h, func(y int) {
+		for x := range w {
+			c, visible := pixel(x, y)
+			if !visible {
+				dst.Pix[y*dst.Stride+x] = transparentIndex
+				continue
+			}
+			r, g, b := int(c.R), int(c.G), int(c.B)
+			if matrix != nil && dithered(x, y) {
+				offset := int(math.Round(matrix[y%dither.Bayer][x%dither.Bayer] * spread))
+				r, g, b = r+offset, g+offset, b+offset
+			}
+			dst.Pix[y*dst.Stride+x] = lookup.nearest(r, g, b)
+		}
+	})
+	return dst
+}
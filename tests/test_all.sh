@@ -2,6 +2,9 @@
 
 echo "🚀 Starting comprehensive CLI testing..."
 
+# Build the binary under test from the current source
+go build -o tti . || exit 1
+
 # Create test results directory
 mkdir -p test-results
 cd test-results
@@ -43,7 +46,7 @@ for font in roboto_bold roboto_regular roboto_medium roboto_black; do
 done
 
 echo "📝 Category 3: All Backgrounds"
-for bg in default perlin perlin-s radial diagonal; do
+for bg in default perlin perlin-s perlin-fbm perlin-warp simplex radial diagonal; do
     run_test "../tti -bg=$bg \"Background: $bg\"" "Background: $bg"
 done
 
@@ -59,7 +62,198 @@ echo "📝 Category 6: Special Effects"
 run_test '../tti -reveal-bg "Reveal Test"' "Reveal background"
 run_test '../tti -animate "Animation Test"' "Animation"
 
-echo "📝 Category 7: Complex Combinations"
+echo "📝 Category 7: Supersampling"
+for n in 2 4; do
+    run_test "../tti -supersample=$n -bg=diagonal \"Supersample: $n\"" "Supersample: $n"
+done
+run_test '../tti -supersample=2 -animate -bg=radial "Supersampled Animation"' "Supersampled animation"
+
+echo "📝 Category 8: Blend Modes"
+for mode in normal multiply screen overlay difference soft-light color-dodge; do
+    run_test "../tti -bg=perlin-s -blend=$mode -opacity=0.8 \"Blend: $mode\"" "Blend: $mode"
+done
+run_test '../tti -reveal-bg -opacity=0.85 "Frosted Knockout"' "Knockout with opacity"
+
+echo "📝 Category 9: Text Styles"
+for style in outline plain neon glitch; do
+    run_test "../tti -style=$style \"Style: $style\"" "Style: $style"
+done
+run_test '../tti -animate -style=neon -flicker -seed=7 "Neon Flicker"' "Animated neon"
+run_test '../tti -animate -style=glitch -seed=7 "Glitch Anim"' "Animated glitch"
+
+echo "📝 Category 10: Seeded Noise and Background Parameters"
+for seed in 1 2 3; do
+    run_test "../tti -bg=simplex -seed=$seed \"Seed: $seed\"" "Simplex seed: $seed"
+done
+run_test '../tti -bg=perlin-fbm:octaves=8,lacunarity=2.2,persistence=0.45,scale=300 "Noise Tuning"' "Noise tuning"
+run_test '../tti -bg=diagonal:grid=20,angle=30 "Stripes"' "Diagonal parameters"
+run_test '../tti -bg=radial:spokes=2,cx=0.25 "Off Center"' "Radial parameters"
+run_test '../tti -list-bg' "List backgrounds"
+
+echo "📝 Category 11: Palettes"
+for palette in studio sunset ocean monochrome pastel cyberpunk; do
+    run_test "../tti -bg=perlin -palette=$palette \"Palette: $palette\"" "Palette: $palette"
+done
+printf 'GIMP Palette\nName: test\n255 0 0 red\n0 0 255 blue\n' > test.gpl
+run_test '../tti -bg=diagonal -palette=test.gpl "GIMP Palette"' "GIMP palette file"
+printf 'ASEF\0\1\0\0\0\0\0\1\0\1\377\377\377\377' > huge.ase
+run_test '! ../tti -palette=huge.ase "Huge Block"' "Rejects oversized ASE block"
+run_test '../tti -animate -bg=simplex -palette=cyberpunk "Palette GIF"' "Palette GIF"
+run_test '../tti -bg=perlin-s -palette-from="../examples/Hello_there!.png" -palette-size=6 "Extracted Palette"' "Palette from image"
+run_test '../tti -output=solid -bg=linear-gradient:stops=ff0000/ff0000 " " && ! ../tti -palette-from=solid/_.png -bg=dots "One Color"' "Rejects single color palette image"
+
+echo "📝 Category 12: Image Backgrounds"
+for fit in cover contain stretch tile center; do
+    run_test "../tti -bg-image=../examples/Hello_there!.png -bg-fit=$fit \"Fit: $fit\"" "Image fit: $fit"
+done
+run_test '../tti -bg-image="../examples/Hello_there!.png" -bg-blur=4 -bg-darken=0.3 -bg-desaturate=0.5 "Adjusted Photo"' "Image adjustments"
+run_test '../tti -bg-image="../examples/Hello_there!.gif" -reveal-bg "Photo Cutout"' "Image with reveal"
+run_test '../tti -width=1 -height=1 -output=tiny -bg=linear-gradient:stops=ff0000/ff0000 " " && ../tti -bg-image=tiny/_.png -bg-fit=cover "Tiny Photo"' "Tiny image covers the canvas"
+
+echo "📝 Category 13: Gradients"
+for space in srgb linear oklab; do
+    run_test "../tti -bg=linear-gradient:stops=0000ff/ffff00,angle=0,space=$space \"Space: $space\"" "Linear gradient: $space"
+done
+run_test '../tti -bg=radial-gradient:stops=ffffff@0/ff8800@0.4/220044,cx=0.3 "Radial Gradient"' "Radial gradient"
+run_test '../tti -bg=conic-gradient:stops=ff0000/00ff00/0000ff/ff0000 "Conic Gradient"' "Conic gradient"
+run_test '../tti -bg=linear-gradient -palette=sunset "Palette Gradient"' "Gradient from palette"
+
+echo "📝 Category 14: Cellular Backgrounds"
+for mode in f1 edge cells; do
+    run_test "../tti -bg=worley:mode=$mode \"Worley: $mode\"" "Worley: $mode"
+done
+run_test '../tti -bg=worley:cells=80,jitter=0.5,border=2 -seed=3 "Stained Glass"' "Worley parameters"
+
+echo "📝 Category 15: Fractals"
+run_test '../tti -bg=mandelbrot -palette=sunset "Mandelbrot"' "Mandelbrot"
+run_test '../tti -bg=julia:cycles=3 "Julia"' "Julia set"
+run_test '../tti -bg=mandelbrot:zoom=200,cx=-0.7436,cy=0.1318,iterations=1500,cycles=4 "Deep Zoom"' "Mandelbrot zoom"
+run_test '! ../tti -bg=mandelbrot:zoom=1e13 "Too Deep"' "Rejects zoom beyond float64 precision"
+for s in 1 2 3; do
+    run_test "../tti -bg=flame -seed=$s \"Flame $s\"" "Flame seed $s"
+done
+
+echo "📝 Category 16: Geometric Patterns"
+for bg in lowpoly hexagon circles chevron dots stripes; do
+    run_test "../tti -bg=$bg \"Geometry: $bg\"" "Geometry: $bg"
+done
+run_test '../tti -bg=lowpoly:points=300,variance=0.2 -palette=ocean -seed=9 "Dense Lowpoly"' "Low-poly parameters"
+run_test '../tti -bg=stripes:angle=30,colors=222222/ffcc00 "Hazard"' "Angled stripes"
+run_test '../tti -bg=dots:layout=grid,radius=0.8 -palette=pastel "Grid Dots"' "Dot grid"
+
+echo "📝 Category 17: Transparency"
+run_test '../tti -bg=none "Transparent"' "Transparent background"
+run_test '../tti -bg=none -reveal-bg "Transparent Reveal"' "Reveal on transparent canvas"
+run_test '../tti -bg=perlin -bg-opacity=0.5 "Half Opacity"' "Background opacity"
+run_test '../tti -bg=none -style=neon "Transparent Neon"' "Neon overlay"
+run_test '../tti -bg=none -animate "Transparent GIF"' "Transparent GIF"
+
+echo "📝 Category 18: Tileable Backgrounds"
+for bg in perlin-fbm simplex worley hexagon dots stripes:angle=30 lowpoly; do
+    run_test "../tti -bg=$bg -tileable -check-seams \"Tile: $bg\"" "Tileable $bg"
+done
+run_test '../tti -bg=perlin-fbm -tileable -supersample=2 -check-seams "Tile Supersampled"' "Tileable supersampled"
+run_test '../tti -bg=worley -tileable -animate "Tile GIF"' "Tileable GIF"
+# a plain noise background must fail the seam check
+run_test '! ../tti -bg=perlin -check-seams "Seam Fail"' "Seam check detects seams"
+
+echo "📝 Category 19: GIF Palettes"
+run_test '../tti -animate -bg=radial -quantizer=median-cut "Median Cut"' "Median cut palette"
+run_test '../tti -animate -bg=radial -quantizer=octree "Octree"' "Octree palette"
+run_test '../tti -animate -bg=perlin -quantizer=fixed "Fixed Palette"' "Fixed palette"
+run_test '../tti -animate -bg=conic-gradient -colors=32 -frame-palettes "Frame Palettes"' "Per-frame palettes"
+run_test '../tti -animate -bg=none -colors=8 "Few Colors"' "Transparent with few colors"
+run_test '! ../tti -animate -colors=300 "Too Many"' "Rejects too many colors"
+
+echo "📝 Category 20: Dithering"
+for dither in floyd-steinberg atkinson sierra bayer2 bayer4 bayer8; do
+    run_test "../tti -animate -bg=radial -colors=16 -dither=$dither \"Dither: $dither\"" "Dither $dither"
+done
+run_test '../tti -animate -bg=perlin -colors=8 -dither=atkinson -crisp-text "Crisp Text"' "Crisp text"
+run_test '../tti -animate -bg=none -colors=4 -dither=floyd-steinberg "Transparent Dither"' "Dithered transparency"
+run_test '! ../tti -animate -dither=random "Bad Dither"' "Rejects unknown dither"
+
+echo "📝 Category 21: Animation Effects"
+for effect in typewriter fade-in slide-left slide-right slide-top slide-bottom zoom bounce wave rainbow shake cursor; do
+    run_test "../tti -animate -effect=$effect \"Effect: $effect\"" "Effect $effect"
+done
+run_test '../tti -animate -effect=wave -style=neon "Neon Wave"' "Effect with text style"
+run_test '../tti -animate -effect=zoom -supersample=2 -font-size=60 "Zoom Supersampled"' "Effect supersampled"
+run_test '../tti -animate -effect=typewriter "Typed over two lines of wrapped text here"' "Typewriter over lines"
+run_test '../tti -animate -effect=slide-left -dither=floyd-steinberg -colors=32 -crisp-text "Crisp Slide"' "Effect with crisp text"
+run_test '! ../tti -animate -effect=fade-in -reveal-bg "Reveal Effect"' "Rejects reveal with effects"
+
+echo "📝 Category 22: Timelines"
+run_test '../tti -timeline=../examples/timeline.json -bg=perlin-fbm "Timeline"' "Example timeline"
+echo '{"duration": 1, "fps": 10, "text": {"rotation": [{"t": 0, "value": 0}, {"t": 1, "value": 360}], "color": [{"t": 0, "value": "#ff0000"}, {"t": 1, "value": "#0000ff"}]}}' > spin.json
+run_test '../tti -timeline=spin.json -style=neon "Spin"' "Rotation and color tracks"
+echo '{"duration": 1, "fps": 8, "background": {"zoom": [{"t": 0, "value": 1}, {"t": 1, "value": 4, "ease": "ease-in"}]}}' > zoom.json
+run_test '../tti -timeline=zoom.json -bg=mandelbrot -supersample=2 "Zoom"' "Background track"
+run_test '! ../tti -timeline=zoom.json -bg=perlin "Wrong Parameter"' "Rejects unknown background parameter"
+run_test '! ../tti -timeline=spin.json -effect=wave "Timeline Effect"' "Rejects timeline with effect"
+run_test '../tti -timeline=../examples/timeline.yaml -bg=perlin-fbm -output=yaml "Timeline" && cmp yaml/Timeline.gif images/Timeline.gif' "YAML timeline matches JSON"
+printf 'duration: 1\nfps: 10\ntext:\n  spin: [{t: 0, value: 1}]\n' > spin.yml
+run_test '! ../tti -timeline=spin.yml "Unknown Track"' "Rejects unknown YAML track"
+
+echo "📝 Category 23: Easing and Timing"
+run_test '../tti -animate -effect=slide-left -easing=bounce "Bouncy Slide"' "Bounce easing"
+run_test '../tti -animate -effect=zoom -easing=steps:4 "Stepped Zoom"' "Stepped easing"
+run_test '../tti -animate -effect=fade-in -easing=elastic "Elastic Fade"' "Overshooting fade"
+run_test '../tti -animate -effect=wave -fps=30 -duration=2 "Smooth Wave"' "Frame rate and duration"
+run_test '../tti -animate -duration=1 "Quick Classic"' "Classic with duration"
+echo '{"text": {"x": [{"t": 0, "value": -200}, {"t": 1, "value": 0, "ease": "elastic"}], "scale": [{"t": 1, "value": 1}, {"t": 2, "value": 1.5, "ease": "back"}]}}' > ease.json
+run_test '../tti -timeline=ease.json -duration=2 -fps=15 "Eased Timeline"' "Timeline timed by flags"
+run_test '! ../tti -timeline=ease.json "No Duration"' "Rejects timeline without duration"
+run_test '! ../tti -animate -fps=60 "Too Fast"' "Rejects fps above 50"
+run_test '! ../tti -animate -easing=wobble "Bad Easing"' "Rejects unknown easing"
+
+echo "📝 Category 24: Playback"
+run_test '../tti -animate -loop=1 "Play Once"' "Play once"
+run_test '../tti -animate -effect=bounce -loop=3 "Three Loops"' "Loop count"
+run_test '../tti -animate -frame-delay=250 "Slow Frames"' "Frame delay"
+run_test '../tti -animate -effect=typewriter -hold=2 "Held Text"' "Hold last frame"
+run_test '../tti -animate -effect=slide-top -pingpong "Ping Pong"' "Ping-pong playback"
+run_test '! ../tti -animate -loop=-1 "Bad Loop"' "Rejects negative loop"
+run_test '! ../tti -animate -frame-delay=100 -duration=2 "Delay And Duration"' "Rejects frame delay with duration"
+run_test '! ../tti -animate -hold=700 "Long Hold"' "Rejects hold beyond the GIF delay range"
+run_test '! ../tti -animate -frame-delay=700000 "Long Delay"' "Rejects frame delay beyond the GIF delay range"
+
+echo "📝 Category 25: Animated Backgrounds"
+for bg in default perlin-fbm perlin-warp simplex radial diagonal worley linear-gradient; do
+    run_test "../tti -animate -animate-bg -bg=$bg \"Moving $bg\"" "Animated $bg"
+done
+run_test '../tti -animate -animate-bg -effect=wave -bg=perlin-fbm -tileable "Tiled Flow"' "Animated tileable noise"
+run_test '../tti -timeline=spin.json -animate-bg -bg=radial "Spinning Rings"' "Animated background in timeline"
+run_test '! ../tti -animate -animate-bg -bg-image="../examples/Hello_there!.png" "Still Photo"' "Rejects animated image background"
+run_test '! ../tti -animate -animate-bg -bg=none "Nothing Moves"' "Rejects animated transparent background"
+run_test '! ../tti -animate -animate-bg -bg=stripes:colors=ff0000/0000ff "Fixed Stripes"' "Rejects animated background with fixed colors"
+
+echo "📝 Category 26: GIF Optimization"
+run_test '../tti -animate -effect=typewriter "Typed Delta"' "Delta frames over a still background"
+run_test '../tti -animate -animate-bg -bg=perlin-fbm "Flowing Delta"' "Delta frames over a moving background"
+run_test '../tti -animate -bg=none -effect=slide-left "Transparent Delta"' "Delta frames with transparency"
+run_test '../tti -animate -effect=shake -frame-palettes -pingpong "Palette Delta"' "Delta frames with frame palettes"
+run_test '../tti -animate -effect=wave -optimize=false "Full Frames"' "Full frames"
+run_test '../tti -animate -effect=bounce "Size Report" | grep -q "Frame differencing"' "Reports pixels stored"
+
+echo "📝 Category 27: APNG Output"
+run_test '../tti -animate -format=apng "Animated PNG"' "Classic APNG"
+run_test '../tti -animate -format=apng -effect=slide-left -bg=linear-gradient "Smooth Gradient"' "APNG effect over a gradient"
+run_test '../tti -animate -format=apng -bg=none -effect=fade-in -pingpong "Alpha Fade"' "APNG with alpha"
+run_test '../tti -animate -format=apng -animate-bg -bg=perlin-fbm -loop=2 "Flowing PNG"' "APNG animated background"
+run_test '../tti -timeline=spin.json -format=apng -optimize=false "Spin PNG"' "APNG timeline with full frames"
+run_test '! ../tti -animate -format=mp4 "Bad Format"' "Rejects unknown format"
+
+echo "📝 Category 28: WebP Output"
+run_test '../tti -format=webp "Still WebP"' "Lossless still image"
+run_test '../tti -format=webp -bg=none "Transparent WebP"' "Still image with alpha"
+run_test '../tti -animate -format=webp "Animated WebP"' "Classic WebP animation"
+run_test '../tti -animate -format=webp -effect=fade-in -bg=none -pingpong -loop=2 "Alpha WebP"' "WebP animation with alpha"
+run_test '../tti -animate -format=webp -animate-bg -bg=simplex "Flowing WebP"' "WebP animated background"
+run_test '../tti -timeline=spin.json -format=webp -optimize=false "Spin WebP"' "WebP timeline with full frames"
+run_test '../tti -animate -format=webp "WebP File" && test -f images/WebP_File.webp' "Writes a .webp file"
+
+echo "📝 Category 29: Complex Combinations"
 run_test '../tti -width=1024 -height=768 -font-size=48 -font=roboto_italic -bg=perlin -animate "Full Combo"' "All parameters"
 
 # Final results
@@ -13,19 +13,45 @@ import (
 // TextRenderer handles different text rendering styles
 type TextRenderer struct {
 	face font.Face
+	// outline thickness in pixels, grows with the supersampling factor
+	outlineWidth int
+	// how text layers are composited onto the background
+	blend   BlendFunc
+	opacity float64
+	// seed for styles with random elements
+	seed   int64
+	neon   NeonStyle
+	glitch GlitchStyle
 }
 
 func NewTextRenderer(face font.Face) *TextRenderer {
-	return &TextRenderer{face: face}
+	return &TextRenderer{
+		face:         face,
+		outlineWidth: 1,
+		blend:        blendNormal,
+		opacity:      1,
+		neon:         defaultNeonStyle(),
+		glitch:       defaultGlitchStyle(),
+	}
+}
+
+// composite draws onto a transparent layer and blends it onto img using the
+// renderer's blend mode and opacity
+func (tr *TextRenderer) composite(img *image.RGBA, drawLayer func(layer *image.RGBA)) {
+	layer := image.NewRGBA(img.Bounds())
+	drawLayer(layer)
+	compositeLayer(img, layer, tr.blend, tr.opacity)
 }
 
-func (tr *TextRenderer) applyTextMask(originalImg, outputImg, mask *image.RGBA) {
-	bounds := originalImg.Bounds()
+// knockout clears the layer wherever the mask has text so the background
+// shows through once the layer is composited
+func (tr *TextRenderer) knockout(layer, mask *image.RGBA) {
+	bounds := layer.Bounds()
 	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
 		for px := bounds.Min.X; px < bounds.Max.X; px++ {
 			maskColor := mask.At(px, py).(color.RGBA)
 			if maskColor.A > 0 {
-				outputImg.Set(px, py, originalImg.At(px, py))
+				layer.SetRGBA(px, py, color.RGBA{})
 			}
 		}
 	}
@@ -75,6 +101,7 @@ func (tr *TextRenderer) renderWithOutline(img *image.RGBA, text string, x, y int
 	}
 
 	for _, off := range offsets {
+		off = off.Mul(tr.outlineWidth)
 		tr.renderText(img, text, x+off.X, y+off.Y, outlineColor)
 	}
 }
@@ -123,8 +150,8 @@ func (tr *TextRenderer) RenderRevealBackground(img *image.RGBA, lines []string,
 		tr.renderText(mask, line, x, y, color.Black)
 	}
 
-	outputImg := image.NewRGBA(img.Bounds())
-	draw.Draw(outputImg, outputImg.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	cover := image.NewRGBA(img.Bounds())
+	draw.Draw(cover, cover.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
 
 	if withOutline {
 		for i, line := range lines {
@@ -136,12 +163,12 @@ func (tr *TextRenderer) RenderRevealBackground(img *image.RGBA, lines []string,
 				x = startX
 			}
 			y := startY + i*lineSpacing
-			tr.renderWithOutline(outputImg, line, x, y, color.Black)
+			tr.renderWithOutline(cover, line, x, y, color.Black)
 		}
 	}
 
-	tr.applyTextMask(img, outputImg, mask)
-	draw.Draw(img, img.Bounds(), outputImg, image.Point{}, draw.Src)
+	tr.knockout(cover, mask)
+	compositeLayer(img, cover, tr.blend, tr.opacity)
 }
 
 // New helper method for centered reveal background
@@ -157,18 +184,18 @@ func (tr *TextRenderer) RenderRevealBackgroundCentered(img *image.RGBA, lines []
 		tr.renderText(mask, line, lineX, y, color.Black)
 	}
 
-	outputImg := image.NewRGBA(img.Bounds())
-	draw.Draw(outputImg, outputImg.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	cover := image.NewRGBA(img.Bounds())
+	draw.Draw(cover, cover.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
 
 	if withOutline {
 		for i, line := range lines {
 			width, _ := measureText(line, primaryFace)
 			lineX := max((imgWidth-width)/2, 0)
 			y := startY + i*lineHeight
-			tr.renderWithOutline(outputImg, line, lineX, y, color.Black)
+			tr.renderWithOutline(cover, line, lineX, y, color.Black)
 		}
 	}
 
-	tr.applyTextMask(img, outputImg, mask)
-	draw.Draw(img, img.Bounds(), outputImg, image.Point{}, draw.Src)
+	tr.knockout(cover, mask)
+	compositeLayer(img, cover, tr.blend, tr.opacity)
 }
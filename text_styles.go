@@ -0,0 +1,218 @@
+// text styles: outlined, plain, neon and glitch
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand/v2"
+)
+
+// TextStyleFunc renders lines at their origins. frame is the animation frame
+// index (0 for static images) so styles can vary deterministically over time
+type TextStyleFunc func(tr *TextRenderer, img *image.RGBA, lines []string, origins []image.Point, frame int)
+
+// Text style mapping
+var textStyleMap = map[string]TextStyleFunc{
+	"outline": (*TextRenderer).RenderOutlined,
+	"plain":   (*TextRenderer).RenderPlain,
+	"neon":    (*TextRenderer).RenderNeon,
+	"glitch":  (*TextRenderer).RenderGlitch,
+}
+
+// styles whose look changes from frame to frame
+var animatedTextStyles = map[string]bool{
+	"neon":   true,
+	"glitch": true,
+}
+
+// NeonStyle configures the neon tube look
+type NeonStyle struct {
+	Color   color.RGBA // glow color; the core is a whitened version of it
+	Layers  int        // number of glow layers, each twice as wide as the last
+	Radius  int        // blur radius of the innermost glow layer
+	Flicker bool       // dim the glow at random across animation frames
+}
+
+// GlitchStyle configures the digital glitch look
+type GlitchStyle struct {
+	Shift     int // horizontal offset of the red and blue channels
+	Slices    int // number of horizontally displaced bands
+	MaxOffset int // largest band displacement
+	Scanlines int // spacing between darkened rows, 0 disables them
+}
+
+func defaultNeonStyle() NeonStyle {
+	return NeonStyle{Color: color.RGBA{255, 43, 214, 255}, Layers: 3, Radius: 4}
+}
+
+func defaultGlitchStyle() GlitchStyle {
+	return GlitchStyle{Shift: 4, Slices: 6, MaxOffset: 12, Scanlines: 3}
+}
+
+func getTextStyles() []string {
+	return getSortedKeys(textStyleMap)
+}
+
+// frameRand returns a generator that depends only on the seed and frame, so
+// every render of the same frame looks identical
+func frameRand(seed int64, frame int) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), uint64(frame)))
+}
+
+// lineOrigins returns the dot position of each horizontally centered line
+func (tr *TextRenderer) lineOrigins(lines []string, imgWidth, startY, lineHeight int) []image.Point {
+	origins := make([]image.Point, len(lines))
+	for i, line := range lines {
+		width, _ := measureText(line, tr.face)
+		origins[i] = image.Pt(max((imgWidth-width)/2, 0), startY+i*lineHeight)
+	}
+	return origins
+}
+
+// RenderOutlined draws white text with a black outline
+func (tr *TextRenderer) RenderOutlined(img *image.RGBA, lines []string, origins []image.Point, _ int) {
+	tr.composite(img, func(layer *image.RGBA) {
+		tr.drawOutlined(layer, lines, origins)
+	})
+}
+
+// RenderPlain draws white text without an outline
+func (tr *TextRenderer) RenderPlain(img *image.RGBA, lines []string, origins []image.Point, _ int) {
+	tr.composite(img, func(layer *image.RGBA) {
+		for i, line := range lines {
+			tr.renderText(layer, line, origins[i].X, origins[i].Y, color.White)
+		}
+	})
+}
+
+// GlyphMask returns an image that is opaque wherever the outlined text
+// covers a pixel, for keeping the letters out of later pixel processing
+func (tr *TextRenderer) GlyphMask(bounds image.Rectangle, lines []string, origins []image.Point) *image.RGBA {
+	mask := image.NewRGBA(bounds)
+	tr.drawOutlined(mask, lines, origins)
+	return mask
+}
+
+func (tr *TextRenderer) drawOutlined(layer *image.RGBA, lines []string, origins []image.Point) {
+	for i, line := range lines {
+		tr.renderWithOutline(layer, line, origins[i].X, origins[i].Y, color.Black)
+		tr.renderText(layer, line, origins[i].X, origins[i].Y, color.White)
+	}
+}
+
+// RenderNeon draws a bright core surrounded by progressively wider glows
+func (tr *TextRenderer) RenderNeon(img *image.RGBA, lines []string, origins []image.Point, frame int) {
+	style := tr.neon
+
+	intensity := 1.0
+	if style.Flicker {
+		rng := frameRand(tr.seed, frame)
+		intensity = 0.85 + 0.15*rng.Float64()
+		// occasionally the tube almost goes out
+		if rng.Float64() < 0.15 {
+			intensity = 0.2 + 0.3*rng.Float64()
+		}
+	}
+
+	glyphs := image.NewRGBA(img.Bounds())
+	for i, line := range lines {
+		tr.renderText(glyphs, line, origins[i].X, origins[i].Y, style.Color)
+	}
+
+	// widest and faintest glow first
+	for layer := style.Layers; layer >= 1; layer-- {
+		radius := style.Radius * (1 << (layer - 1)) * tr.outlineWidth
+		glow := boxBlur(glyphs, radius)
+		scaleAlpha(glow, 2)
+		compositeLayer(img, glow, tr.blend, intensity*tr.opacity)
+	}
+
+	core := interpolateColor(style.Color, color.RGBA{255, 255, 255, 255}, 0.75)
+	tr.composite(img, func(layer *image.RGBA) {
+		for i, line := range lines {
+			tr.renderText(layer, line, origins[i].X, origins[i].Y, core)
+		}
+	})
+}
+
+// RenderGlitch draws outlined text with split color channels, displaced
+// horizontal slices and scanlines
+func (tr *TextRenderer) RenderGlitch(img *image.RGBA, lines []string, origins []image.Point, frame int) {
+	style := tr.glitch
+	rng := frameRand(tr.seed, frame)
+
+	layer := image.NewRGBA(img.Bounds())
+	tr.drawOutlined(layer, lines, origins)
+
+	layer = splitChannels(layer, style.Shift*tr.outlineWidth)
+	displaceSlices(layer, rng, style.Slices, style.MaxOffset*tr.outlineWidth)
+	if style.Scanlines > 0 {
+		darkenScanlines(layer, style.Scanlines*tr.outlineWidth)
+	}
+
+	compositeLayer(img, layer, tr.blend, tr.opacity)
+}
+
+// splitChannels samples red from the left and blue from the right
+func splitChannels(src *image.RGBA, shift int) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	// pixels past the edges are transparent
+	sample := func(x, y int) [4]uint8 {
+		if x < 0 || x >= w {
+			return [4]uint8{}
+		}
+		o := y*src.Stride + x*4
+		return [4]uint8(src.Pix[o : o+4])
+	}
+
+	for y := range h {
+		for x := range w {
+			r, g, b := sample(x-shift, y), sample(x, y), sample(x+shift, y)
+			o := y*dst.Stride + x*4
+			dst.Pix[o] = r[0]
+			dst.Pix[o+1] = g[1]
+			dst.Pix[o+2] = b[2]
+			// premultiplied colors must not exceed alpha
+			dst.Pix[o+3] = max(r[3], g[3], b[3])
+		}
+	}
+	return dst
+}
+
+// displaceSlices shifts random horizontal bands sideways
+func displaceSlices(img *image.RGBA, rng *rand.Rand, slices, maxOffset int) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if maxOffset <= 0 || h == 0 {
+		return
+	}
+	row := make([]uint8, w*4)
+
+	for range slices {
+		y0 := rng.IntN(h)
+		height := 1 + rng.IntN(max(h/10, 1))
+		offset := rng.IntN(2*maxOffset+1) - maxOffset
+
+		for y := y0; y < min(y0+height, h); y++ {
+			line := img.Pix[y*img.Stride : y*img.Stride+w*4]
+			clear(row)
+			for x := range w {
+				if sx := x - offset; sx >= 0 && sx < w {
+					copy(row[x*4:x*4+4], line[sx*4:sx*4+4])
+				}
+			}
+			copy(line, row)
+		}
+	}
+}
+
+// darkenScanlines halves every spacing-th row
+func darkenScanlines(img *image.RGBA, spacing int) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	for y := 0; y < h; y += spacing {
+		line := img.Pix[y*img.Stride : y*img.Stride+w*4]
+		for i := range line {
+			line[i] /= 2
+		}
+	}
+}
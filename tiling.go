@@ -0,0 +1,198 @@
+// seamless tiling: periodic noise fields, a crossfade fallback for other
+// generators and a seam continuity check
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// share of the canvas the crossfade fallback blends across each edge
+const tileBlendFraction = 0.25
+
+// fitPeriod returns the period nearest to period that fits a whole number
+// of times into length, along with that number
+func fitPeriod(length, period float64) (float64, int) {
+	n := max(1, int(math.Round(length/period)))
+	return length / float64(n), n
+}
+
+// fitDirection snaps a projection vector so a projection repeating every
+// period advances whole periods across a w by h canvas
+func fitDirection(kx, ky, w, h, period float64) (float64, float64) {
+	fx := math.Round(w*kx/period) * period / w
+	fy := math.Round(h*ky/period) * period / h
+	if fx == 0 && fy == 0 {
+		// too coarse for the canvas, fall back to one period along the main axis
+		if math.Abs(kx) >= math.Abs(ky) {
+			fx = math.Copysign(period/w, kx)
+		} else {
+			fy = math.Copysign(period/h, ky)
+		}
+	}
+	return fx, fy
+}
+
+// wrapIndex wraps a lattice index into [0, period), periods of 0 or less
+// leave it unchanged
+func wrapIndex(i, period int) int {
+	if period <= 0 {
+		return i
+	}
+	return ((i % period) + period) % period
+}
+
+// periodicField makes a noise field repeat every pw by ph units by blending
+// it with copies shifted by one period, weighted by the distance to each
+// copy. The blend weights match on opposite edges, so the result wraps
+func periodicField(field NoiseFunc, pw, ph float64) NoiseFunc {
+	return func(x, y float64) float64 {
+		x = x - math.Floor(x/pw)*pw
+		y = y - math.Floor(y/ph)*ph
+		u, v := x/pw, y/ph
+		return field(x, y)*(1-u)*(1-v) +
+			field(x-pw, y)*u*(1-v) +
+			field(x, y-ph)*(1-u)*v +
+			field(x-pw, y-ph)*u*v
+	}
+}
+
+// makeTileable renders a generator on a larger canvas and crossfades the
+// overflow into the opposite edges, so any generator tiles at the cost of
+// some ghosting near the borders
+func makeTileable(gen BackgroundGenFunc) BackgroundGenFunc {
+	return func(w, h int, params BackgroundParams) *image.RGBA {
+		mx := max(1, int(float64(w)*tileBlendFraction))
+		my := max(1, int(float64(h)*tileBlendFraction))
+		src := gen(w+mx, h+my, params)
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+		// pixel (x, y) mixes with its copy one canvas width and height away,
+		// fully the copy at the left and top edge and not at all past the margin
+		parallelRows(h, func(y int) {
+			// rows inside the top margin also mix with the row one canvas below
+			ty, below := 1.0, 0
+			if y < my {
+				ty, below = float64(y)/float64(my), src.PixOffset(0, y+h)
+			}
+			row, d := src.PixOffset(0, y), dst.PixOffset(0, y)
+			// the source pixel at x mixed with its copy one canvas to the right
+			mix := func(start, x, c int, tx float64) float64 {
+				v := float64(src.Pix[start+x*4+c])
+				if tx < 1 {
+					v = lerp(float64(src.Pix[start+(x+w)*4+c]), v, tx)
+				}
+				return v
+			}
+			for x := range w {
+				tx := 1.0
+				if x < mx {
+					tx = float64(x) / float64(mx)
+				}
+				for c := range 4 {
+					v := mix(row, x, c, tx)
+					if ty < 1 {
+						v = lerp(mix(below, x, c, tx), v, ty)
+					}
+					dst.Pix[d+x*4+c] = uint8(math.Round(v))
+				}
+			}
+		})
+		return dst
+	}
+}
+
+// color difference, summed over the channels, that counts as an edge
+const seamEdgeThreshold = 32
+
+// how much the seam may jump more than the sharpest line inside the image
+const maxSeamScore = 1.5
+
+// seamStats compares the pixels across a wrap-around edge with neighbouring
+// rows or columns inside the image
+type seamStats struct {
+	// average color jump across the seam and across the sharpest line
+	// boundary inside the image
+	seam, worst float64
+	// share of pixel pairs that form an edge, across the seam and for the
+	// most edgy boundary inside the image
+	seamEdges, worstEdges float64
+}
+
+// score is the seam jump relative to the sharpest interior boundary, 1 or
+// less when the seam is no harsher than the texture itself
+func (s seamStats) score() float64 {
+	if s.worst == 0 {
+		if s.seam == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return s.seam / s.worst
+}
+
+// patterns may have hard edges of their own, so a seam fails when it jumps
+// well beyond them or breaks more pixels than any boundary inside does
+func (s seamStats) ok() bool {
+	return s.score() <= maxSeamScore && s.seamEdges <= s.worstEdges+0.05
+}
+
+// seamScore measures the left/right and top/bottom seams of an image
+func seamScore(img *image.RGBA) (horizontal, vertical seamStats) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	diff := func(x0, y0, x1, y1 int) float64 {
+		a, b := img.PixOffset(x0, y0), img.PixOffset(x1, y1)
+		sum := 0.0
+		for c := range 4 {
+			sum += math.Abs(float64(img.Pix[a+c]) - float64(img.Pix[b+c]))
+		}
+		return sum
+	}
+	// compare(i, j) returns the average difference between lines i and j
+	// and the share of their pixels that differ by more than the threshold
+	measure := func(lines int, compare func(i, j int) (float64, float64)) seamStats {
+		var stats seamStats
+		stats.seam, stats.seamEdges = compare(lines-1, 0)
+		for i := range lines - 1 {
+			d, edges := compare(i, i+1)
+			stats.worst = max(stats.worst, d)
+			stats.worstEdges = max(stats.worstEdges, edges)
+		}
+		return stats
+	}
+
+	horizontal = measure(w, func(i, j int) (float64, float64) {
+		sum, edges := 0.0, 0.0
+		for y := range h {
+			d := diff(i, y, j, y)
+			sum += d
+			if d > seamEdgeThreshold {
+				edges++
+			}
+		}
+		return sum / float64(h), edges / float64(h)
+	})
+	vertical = measure(h, func(i, j int) (float64, float64) {
+		sum, edges := 0.0, 0.0
+		for x := range w {
+			d := diff(x, i, x, j)
+			sum += d
+			if d > seamEdgeThreshold {
+				edges++
+			}
+		}
+		return sum / float64(w), edges / float64(w)
+	})
+	return horizontal, vertical
+}
+
+// checkSeams prints the seam scores and fails when an edge doesn't match
+func checkSeams(img *image.RGBA) error {
+	horizontal, vertical := seamScore(img)
+	fmt.Printf("🔁 Seam check: left/right %.2f, top/bottom %.2f (1 or less matches the interior)\n", horizontal.score(), vertical.score())
+	if !horizontal.ok() || !vertical.ok() {
+		return fmt.Errorf("background does not tile, its seams break more pixels than any edge inside the image")
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+// keyframe timelines describing an animation in a JSON or YAML file
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+	"gopkg.in/yaml.v3"
+)
+
+// Keyframe sets a track to Value at T seconds, Ease shapes the change from
+// the previous keyframe and defaults to linear
+type Keyframe[V any] struct {
+	T     float64 `json:"t" yaml:"t"`
+	Value V       `json:"value" yaml:"value"`
+	Ease  string  `json:"ease" yaml:"ease"`
+}
+
+// TextTracks animate the text. X and Y offset it in pixels from its
+// centered place, Rotation turns it clockwise in degrees around its center
+// and Color tints the style's white parts
+type TextTracks struct {
+	X        []Keyframe[float64] `json:"x" yaml:"x"`
+	Y        []Keyframe[float64] `json:"y" yaml:"y"`
+	Scale    []Keyframe[float64] `json:"scale" yaml:"scale"`
+	Rotation []Keyframe[float64] `json:"rotation" yaml:"rotation"`
+	Opacity  []Keyframe[float64] `json:"opacity" yaml:"opacity"`
+	Color    []Keyframe[string]  `json:"color" yaml:"color"`
+}
+
+// Timeline is an animation of Duration seconds at FPS frames per second,
+// -duration and -fps fill in either when the file leaves it out
+type Timeline struct {
+	Duration float64    `json:"duration" yaml:"duration"`
+	FPS      float64    `json:"fps" yaml:"fps"`
+	Text     TextTracks `json:"text" yaml:"text"`
+	// numeric parameters of the -bg generator
+	Background map[string][]Keyframe[float64] `json:"background" yaml:"background"`
+}
+
+// loadTimeline reads and validates a timeline file against the configured
+// background, .yaml and .yml files are read as YAML and anything else as JSON
+func loadTimeline(path string, config Config) (*Timeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("unable to read timeline: " + err.Error())
+	}
+	var tl Timeline
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&tl)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&tl)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeline %s: %v", path, err)
+	}
+	if tl.Duration == 0 {
+		tl.Duration = config.Duration
+	}
+	if tl.FPS == 0 {
+		tl.FPS = config.FPS
+	}
+	if err := tl.validate(config); err != nil {
+		return nil, fmt.Errorf("invalid timeline %s: %v", path, err)
+	}
+	return &tl, nil
+}
+
+func (tl *Timeline) validate(config Config) error {
+	if tl.Duration <= 0 {
+		return errors.New("needs a positive duration, in the file or through -duration")
+	}
+	if tl.FPS <= 0 || tl.FPS > maxFPS {
+		return fmt.Errorf("fps must be between 0 and %d", maxFPS)
+	}
+	if n := frameCount(tl.Duration, tl.FPS); n > maxAnimationFrames {
+		return fmt.Errorf("at most %d frames, got %d", maxAnimationFrames, n)
+	}
+
+	numeric := map[string]struct {
+		keys     []Keyframe[float64]
+		min, max float64
+	}{
+		"x":        {tl.Text.X, math.Inf(-1), math.Inf(1)},
+		"y":        {tl.Text.Y, math.Inf(-1), math.Inf(1)},
+		"scale":    {tl.Text.Scale, 0, 10},
+		"rotation": {tl.Text.Rotation, math.Inf(-1), math.Inf(1)},
+		"opacity":  {tl.Text.Opacity, 0, 1},
+	}
+	for _, name := range getSortedKeys(numeric) {
+		track := numeric[name]
+		if err := validateTrack("text "+name, track.keys); err != nil {
+			return err
+		}
+		for _, k := range track.keys {
+			if k.Value < track.min || k.Value > track.max {
+				return fmt.Errorf("text %s must be between %g and %g", name, track.min, track.max)
+			}
+		}
+	}
+	if err := validateTrack("text color", tl.Text.Color); err != nil {
+		return err
+	}
+	for _, k := range tl.Text.Color {
+		if _, err := parseHexColor(k.Value); err != nil {
+			return fmt.Errorf("text color: %v", err)
+		}
+	}
+
+	if len(tl.Background) == 0 {
+		return nil
+	}
+	if config.BackgroundImage != "" {
+		return errors.New("background tracks need a generated -bg, not -bg-image")
+	}
+	spec, _, err := parseBackground(config.Background)
+	if err != nil {
+		return err
+	}
+	for _, name := range getSortedKeys(tl.Background) {
+		keys := tl.Background[name]
+		i := slices.IndexFunc(spec.Params, func(p ParamSpec) bool { return p.Name == name })
+		if i < 0 {
+			return fmt.Errorf("background has no parameter %q", name)
+		}
+		param := spec.Params[i]
+		if param.Kind != paramNumber && param.Kind != paramInt {
+			return fmt.Errorf("background parameter %s is not numeric", name)
+		}
+		if err := validateTrack("background "+name, keys); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := param.validate(formatParam(param, k.Value)); err != nil {
+				return fmt.Errorf("background %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTrack checks that keyframes are in time order with known easings
+func validateTrack[V any](name string, keys []Keyframe[V]) error {
+	for i, k := range keys {
+		if k.T < 0 || (i > 0 && k.T < keys[i-1].T) {
+			return fmt.Errorf("%s keyframes must have increasing, non-negative times", name)
+		}
+		if _, err := parseEasing(k.Ease); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// segment finds the keyframes around time t and the eased progress between
+// them. Before the first and after the last keyframe the value holds
+func segment[V any](keys []Keyframe[V], t float64) (from, to V, progress float64) {
+	i := slices.IndexFunc(keys, func(k Keyframe[V]) bool { return k.T > t })
+	switch {
+	case i < 0:
+		last := keys[len(keys)-1].Value
+		return last, last, 1
+	case i == 0:
+		return keys[0].Value, keys[0].Value, 0
+	}
+	prev, next := keys[i-1], keys[i]
+	progress = (t - prev.T) / (next.T - prev.T)
+	// validated when the timeline was loaded
+	ease, _ := parseEasing(next.Ease)
+	progress = ease(progress)
+	return prev.Value, next.Value, progress
+}
+
+// valueAt samples a numeric track, empty tracks give fallback
+func valueAt(keys []Keyframe[float64], t, fallback float64) float64 {
+	if len(keys) == 0 {
+		return fallback
+	}
+	from, to, progress := segment(keys, t)
+	return lerp(from, to, progress)
+}
+
+// colorAt samples a color track through OKLab, false when it is empty
+func colorAt(keys []Keyframe[string], t float64) (color.RGBA, bool) {
+	if len(keys) == 0 {
+		return color.RGBA{}, false
+	}
+	from, to, progress := segment(keys, t)
+	// validated when the timeline was loaded
+	a, _ := parseHexColor(from)
+	b, _ := parseHexColor(to)
+	la, lb := rgbaToOKLab(a), rgbaToOKLab(b)
+	return OKLab{lerp(la.L, lb.L, progress), lerp(la.A, lb.A, progress), lerp(la.B, lb.B, progress)}.toRGBA(), true
+}
+
+// formatParam writes a track value as a background parameter string
+func formatParam(param ParamSpec, v float64) string {
+	if param.Kind == paramInt {
+		return strconv.Itoa(int(math.Round(v)))
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// backgroundAt returns the background parameters with the tracks applied at
+// time t
+func (tl *Timeline) backgroundAt(params BackgroundParams, spec BackgroundSpec, t float64) BackgroundParams {
+	params.Values = maps.Clone(params.Values)
+	for _, p := range spec.Params {
+		if keys, exists := tl.Background[p.Name]; exists {
+			params.Values[p.Name] = formatParam(p, valueAt(keys, t, 0))
+		}
+	}
+	return params
+}
+
+// renderFrames draws every frame of the timeline and returns them along
+// with the text layer of each, pixelScale converts the offsets to the
+// render resolution and loopBackground evolves the background over the
+// timeline
+func (tl *Timeline) renderFrames(l textLayout, bgGen BackgroundGenFunc, bgParams BackgroundParams, bgSpec BackgroundSpec, pixelScale float64, loopBackground bool) ([]*image.RGBA, []*image.RGBA, error) {
+	var frames, layers []*image.RGBA
+	var background *image.RGBA
+	for i := range frameCount(tl.Duration, tl.FPS) {
+		t := float64(i) / tl.FPS
+
+		var img *image.RGBA
+		if len(tl.Background) > 0 || loopBackground {
+			params := tl.backgroundAt(bgParams, bgSpec, t)
+			if loopBackground {
+				params.Time = t / tl.Duration
+			}
+			img = bgGen(l.width, l.height, params)
+		} else {
+			// the background stays the same, so it is only generated once
+			if background == nil {
+				background = bgGen(l.width, l.height, bgParams)
+			}
+			img = cloneImage(background)
+		}
+
+		layer, err := tl.textLayer(l, i, t, pixelScale)
+		if err != nil {
+			return nil, nil, err
+		}
+		compositeLayer(img, layer, l.renderer.blend, l.renderer.opacity*valueAt(tl.Text.Opacity, t, 1))
+		frames = append(frames, img)
+		layers = append(layers, layer)
+	}
+	return frames, layers, nil
+}
+
+// textLayer draws the text with the tracks applied at time t onto a
+// transparent layer
+func (tl *Timeline) textLayer(l textLayout, frame int, t, pixelScale float64) (*image.RGBA, error) {
+	layer := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	scale := valueAt(tl.Text.Scale, t, 1)
+	if scale*l.fontSize < 1 {
+		return layer, nil
+	}
+	scaled, release, err := l.scaled(scale)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// the layer is blended onto the frame afterwards
+	tr := *scaled.renderer
+	tr.blend = blendNormal
+	tr.opacity = 1
+	dx := valueAt(tl.Text.X, t, 0) * pixelScale
+	dy := valueAt(tl.Text.Y, t, 0) * pixelScale
+	scaled.draw(&tr, layer, scaled.lines, scaled.shifted(int(math.Round(dx)), int(math.Round(dy))), frame)
+
+	if c, tinted := colorAt(tl.Text.Color, t); tinted {
+		tintLayer(layer, c)
+	}
+	if angle := valueAt(tl.Text.Rotation, t, 0); angle != 0 {
+		layer = rotateLayer(layer, angle, float64(l.width)/2+dx, float64(l.height)/2+dy)
+	}
+	return layer, nil
+}
+
+// tintLayer multiplies the layer's colors by c, so white becomes c and
+// black stays black
+func tintLayer(layer *image.RGBA, c color.RGBA) {
+	for i := 0; i < len(layer.Pix); i += 4 {
+		layer.Pix[i] = uint8(int(layer.Pix[i]) * int(c.R) / 255)
+		layer.Pix[i+1] = uint8(int(layer.Pix[i+1]) * int(c.G) / 255)
+		layer.Pix[i+2] = uint8(int(layer.Pix[i+2]) * int(c.B) / 255)
+	}
+}
+
+// rotateLayer turns the layer clockwise by degrees around cx, cy
+func rotateLayer(layer *image.RGBA, degrees, cx, cy float64) *image.RGBA {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	// maps layer coordinates to rotated coordinates
+	transform := f64.Aff3{
+		cos, -sin, cx - cos*cx + sin*cy,
+		sin, cos, cy - sin*cx - cos*cy,
+	}
+	rotated := image.NewRGBA(layer.Bounds())
+	xdraw.BiLinear.Transform(rotated, transform, layer, layer.Bounds(), draw.Src, nil)
+	return rotated
+}
@@ -0,0 +1,673 @@
+// lossless WebP (VP8L) bitstream encoding
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"image"
+	"math/bits"
+	"slices"
+)
+
+const (
+	vp8lSignature = 0x2f
+	// widths and heights are stored in 14 bits
+	maxVP8LSize = 1 << 14
+	// transforms applied before the pixels are entropy coded
+	vp8lPredictorTransform     = 0
+	vp8lSubtractGreenTransform = 2
+	// predictor blocks are 1 << vp8lPredictorBits pixels wide
+	vp8lPredictorBits = 4
+	vp8lCacheBits     = 10
+	// prefix codes of backward reference lengths and distances
+	vp8lLengthCodes   = 24
+	vp8lDistanceCodes = 40
+	// backward references copy at most vp8lMaxLength pixels, found through
+	// chains of at most vp8lChainDepth earlier positions
+	vp8lMinLength  = 3
+	vp8lMaxLength  = 4096
+	vp8lChainDepth = 32
+	vp8lHashBits   = 16
+	// longest prefix code, and that of the code lengths themselves
+	vp8lMaxCodeLength       = 15
+	vp8lMaxLengthCodeLength = 7
+)
+
+// order in which the code length code lengths are stored
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// short distance codes for nearby pixels, as x and y offsets
+var vp8lDistanceMap = [120][2]int{
+	{0, 1}, {1, 0}, {1, 1}, {-1, 1}, {0, 2}, {2, 0}, {1, 2}, {-1, 2},
+	{2, 1}, {-2, 1}, {2, 2}, {-2, 2}, {0, 3}, {3, 0}, {1, 3}, {-1, 3},
+	{3, 1}, {-3, 1}, {2, 3}, {-2, 3}, {3, 2}, {-3, 2}, {0, 4}, {4, 0},
+	{1, 4}, {-1, 4}, {4, 1}, {-4, 1}, {3, 3}, {-3, 3}, {2, 4}, {-2, 4},
+	{4, 2}, {-4, 2}, {0, 5}, {3, 4}, {-3, 4}, {4, 3}, {-4, 3}, {5, 0},
+	{1, 5}, {-1, 5}, {5, 1}, {-5, 1}, {2, 5}, {-2, 5}, {5, 2}, {-5, 2},
+	{4, 4}, {-4, 4}, {3, 5}, {-3, 5}, {5, 3}, {-5, 3}, {0, 6}, {6, 0},
+	{1, 6}, {-1, 6}, {6, 1}, {-6, 1}, {2, 6}, {-2, 6}, {6, 2}, {-6, 2},
+	{4, 5}, {-4, 5}, {5, 4}, {-5, 4}, {3, 6}, {-3, 6}, {6, 3}, {-6, 3},
+	{0, 7}, {7, 0}, {1, 7}, {-1, 7}, {5, 5}, {-5, 5}, {7, 1}, {-7, 1},
+	{4, 6}, {-4, 6}, {6, 4}, {-6, 4}, {2, 7}, {-2, 7}, {7, 2}, {-7, 2},
+	{3, 7}, {-3, 7}, {7, 3}, {-7, 3}, {5, 6}, {-5, 6}, {6, 5}, {-6, 5},
+	{8, 0}, {4, 7}, {-4, 7}, {7, 4}, {-7, 4}, {8, 1}, {8, 2}, {6, 6},
+	{-6, 6}, {8, 3}, {5, 7}, {-5, 7}, {7, 5}, {-7, 5}, {8, 4}, {6, 7},
+	{-6, 7}, {7, 6}, {-7, 6}, {8, 5}, {7, 7}, {-7, 7}, {8, 6}, {8, 7},
+}
+
+// bitWriter packs values least significant bit first, as VP8L reads them
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	count uint
+}
+
+func (w *bitWriter) write(value uint32, n uint) {
+	w.acc |= uint64(value) << w.count
+	w.count += n
+	for w.count >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.count -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.count > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.count = 0, 0
+	}
+	return w.buf
+}
+
+// encodeVP8L encodes img as a lossless WebP bitstream, without the RIFF
+// container
+func encodeVP8L(img *image.RGBA) ([]byte, error) {
+	b := img.Rect
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxVP8LSize || height > maxVP8LSize {
+		return nil, errors.New("WebP images are 1 to 16384 pixels wide and high")
+	}
+
+	argb := make([]uint32, 0, width*height)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			argb = append(argb, straightARGB(img.Pix[img.PixOffset(x, y):]))
+		}
+	}
+
+	w := &bitWriter{}
+	w.write(vp8lSignature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	alpha := uint32(0)
+	if !img.Opaque() {
+		alpha = 1
+	}
+	w.write(alpha, 1)
+	w.write(0, 3) // version
+
+	// the decoder undoes the transforms in reverse order
+	w.write(1, 1)
+	w.write(vp8lSubtractGreenTransform, 2)
+	subtractGreen(argb)
+	w.write(1, 1)
+	w.write(vp8lPredictorTransform, 2)
+	w.write(vp8lPredictorBits-2, 3)
+	modes, residuals := predict(argb, width, height)
+	blocks := subSampleSize(width, vp8lPredictorBits)
+	writeEntropyImage(w, modes, blocks, 0, false)
+	w.write(0, 1)
+
+	writeEntropyImage(w, residuals, width, vp8lCacheBits, true)
+	return w.bytes(), nil
+}
+
+// straightARGB packs a premultiplied RGBA pixel as the straight ARGB that
+// VP8L stores, invisible pixels all black as their color would only cost space
+func straightARGB(pix []uint8) uint32 {
+	a := uint32(pix[3])
+	if a == 0 {
+		return 0
+	}
+	unmul := func(v uint8) uint32 { return min(255, (uint32(v)*255+a/2)/a) }
+	return a<<24 | unmul(pix[0])<<16 | unmul(pix[1])<<8 | unmul(pix[2])
+}
+
+// subSampleSize is the number of blocks of 1 << bits pixels covering size
+func subSampleSize(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
+
+// subtractGreen takes the green channel out of red and blue, which tend to
+// follow it
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// channel arithmetic of the predictors on packed ARGB pixels
+func perChannel(f func(a, b, c int) int, a, b, c uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := f(int(a>>shift&0xff), int(b>>shift&0xff), int(c>>shift&0xff))
+		out |= uint32(max(0, min(255, v))) << shift
+	}
+	return out
+}
+
+func average2(a, b uint32) uint32 {
+	return perChannel(func(a, b, _ int) int { return (a + b) / 2 }, a, b, 0)
+}
+
+// vp8lPredict returns the prediction of one of the 14 predictor modes from
+// the left, top, top-left and top-right pixels
+func vp8lPredict(mode int, l, t, tl, tr uint32) uint32 {
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		// whichever of left and top is closer to left + top - top-left
+		distance := func(p uint32) int {
+			sum := 0
+			for shift := 0; shift < 32; shift += 8 {
+				estimate := int(l>>shift&0xff) + int(t>>shift&0xff) - int(tl>>shift&0xff)
+				sum += abs(estimate - int(p>>shift&0xff))
+			}
+			return sum
+		}
+		if distance(l) < distance(t) {
+			return l
+		}
+		return t
+	case 12:
+		return perChannel(func(a, b, c int) int { return a + b - c }, l, t, tl)
+	}
+	return perChannel(func(a, b, _ int) int { return a + (a-b)/2 }, average2(l, t), tl, 0)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// residual subtracts the prediction from a pixel channel by channel
+func residual(p, pred uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		out |= ((p>>shift - pred>>shift) & 0xff) << shift
+	}
+	return out
+}
+
+// predict picks the predictor mode of each block with the smallest
+// residuals and returns the modes along with the residual image
+func predict(argb []uint32, width, height int) ([]uint32, []uint32) {
+	size := 1 << vp8lPredictorBits
+	blocksX, blocksY := subSampleSize(width, vp8lPredictorBits), subSampleSize(height, vp8lPredictorBits)
+	modes := make([]uint32, blocksX*blocksY)
+	residuals := make([]uint32, len(argb))
+
+	// the first row and column have fixed predictors
+	at := func(mode, x, y int) uint32 {
+		i := y*width + x
+		switch {
+		case x == 0 && y == 0:
+			return 0xff000000
+		case y == 0:
+			return argb[i-1]
+		case x == 0:
+			return argb[i-width]
+		}
+		// the top right of the last column wraps to the row's first pixel
+		return vp8lPredict(mode, argb[i-1], argb[i-width], argb[i-width-1], argb[i-width+1])
+	}
+
+	parallelRows(blocksY, func(by int) {
+		for bx := range blocksX {
+			best, bestCost := 0, -1
+			for mode := range 14 {
+				cost := 0
+				for y := by * size; y < min(height, (by+1)*size); y++ {
+					for x := bx * size; x < min(width, (bx+1)*size); x++ {
+						r := residual(argb[y*width+x], at(mode, x, y))
+						for shift := 0; shift < 32; shift += 8 {
+							cost += abs(int(int8(r >> shift)))
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[by*blocksX+bx] = 0xff000000 | uint32(best)<<8
+			for y := by * size; y < min(height, (by+1)*size); y++ {
+				for x := bx * size; x < min(width, (bx+1)*size); x++ {
+					residuals[y*width+x] = residual(argb[y*width+x], at(best, x, y))
+				}
+			}
+		}
+	})
+	return modes, residuals
+}
+
+// vp8lToken is a literal pixel, a color cache hit or a backward reference
+type vp8lToken struct {
+	kind     byte // 0 literal, 1 cache, 2 copy
+	value    uint32
+	distance uint32 // distance code of copies
+}
+
+// vp8lPrefix splits a length or distance code into its prefix symbol and
+// extra bits
+func vp8lPrefix(v uint32) (symbol uint32, extraBits uint, extra uint32) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	high := uint(bits.Len32(v)) - 1
+	second := (v >> (high - 1)) & 1
+	extraBits = high - 1
+	return uint32(2*high) + second, extraBits, v & (1<<extraBits - 1)
+}
+
+// tokenize finds backward references through hash chains and color cache
+// hits, in the order the decoder replays them
+func tokenize(argb []uint32, width, cacheBits int) []vp8lToken {
+	// distance codes of the nearby offsets that fit this width
+	shortCodes := map[int]uint32{}
+	for code := len(vp8lDistanceMap); code >= 1; code-- {
+		offset := vp8lDistanceMap[code-1]
+		if d := offset[0] + offset[1]*width; d >= 1 {
+			shortCodes[d] = uint32(code)
+		}
+	}
+	distanceCode := func(d int) uint32 {
+		if code, exists := shortCodes[d]; exists {
+			return code
+		}
+		return uint32(d + len(vp8lDistanceMap))
+	}
+	maxDistance := 1<<20 - len(vp8lDistanceMap)
+
+	hash := func(i int) uint32 {
+		return (argb[i]*0x9e3779b1 ^ argb[i+1]*0x85ebca6b) >> (32 - vp8lHashBits)
+	}
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	chain := make([]int32, len(argb))
+	insert := func(i int) {
+		if i+1 < len(argb) {
+			h := hash(i)
+			chain[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	var cache []uint32
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+	remember := func(p uint32) {
+		if cache != nil {
+			cache[(p*0x1e35a7bd)>>(32-cacheBits)] = p
+		}
+	}
+
+	var tokens []vp8lToken
+	matchLength := func(i, j int) int {
+		n := 0
+		for n < vp8lMaxLength && i+n < len(argb) && argb[i+n] == argb[j+n] {
+			n++
+		}
+		return n
+	}
+	for i := 0; i < len(argb); {
+		bestLength, bestDistance := 0, 0
+		// the previous pixel and the one above are tried first
+		for _, d := range []int{1, width} {
+			if d <= i {
+				if n := matchLength(i, i-d); n > bestLength {
+					bestLength, bestDistance = n, d
+				}
+			}
+		}
+		if i+1 < len(argb) {
+			for j, depth := head[hash(i)], 0; j >= 0 && depth < vp8lChainDepth && i-int(j) <= maxDistance; j, depth = chain[j], depth+1 {
+				if n := matchLength(i, int(j)); n > bestLength {
+					bestLength, bestDistance = n, i-int(j)
+				}
+			}
+		}
+
+		if bestLength >= vp8lMinLength {
+			tokens = append(tokens, vp8lToken{kind: 2, value: uint32(bestLength), distance: distanceCode(bestDistance)})
+			for k := i; k < i+bestLength; k++ {
+				remember(argb[k])
+				insert(k)
+			}
+			i += bestLength
+			continue
+		}
+
+		p := argb[i]
+		if cache != nil {
+			if key := (p * 0x1e35a7bd) >> (32 - cacheBits); cache[key] == p {
+				tokens = append(tokens, vp8lToken{kind: 1, value: key})
+				insert(i)
+				i++
+				continue
+			}
+		}
+		tokens = append(tokens, vp8lToken{value: p})
+		remember(p)
+		insert(i)
+		i++
+	}
+	return tokens
+}
+
+// writeEntropyImage entropy codes an image with a single set of prefix
+// codes. Only the main image says whether it has meta prefix codes
+func writeEntropyImage(w *bitWriter, argb []uint32, width, cacheBits int, main bool) {
+	if cacheBits > 0 {
+		w.write(1, 1)
+		w.write(uint32(cacheBits), 4)
+	} else {
+		w.write(0, 1)
+	}
+	if main {
+		w.write(0, 1)
+	}
+
+	tokens := tokenize(argb, width, cacheBits)
+	cacheSize := 0
+	if cacheBits > 0 {
+		cacheSize = 1 << cacheBits
+	}
+	// green with lengths and cache indices, red, blue, alpha and distance
+	counts := [5][]int{
+		make([]int, 256+vp8lLengthCodes+cacheSize),
+		make([]int, 256), make([]int, 256), make([]int, 256),
+		make([]int, vp8lDistanceCodes),
+	}
+	for _, t := range tokens {
+		switch t.kind {
+		case 0:
+			counts[0][t.value>>8&0xff]++
+			counts[1][t.value>>16&0xff]++
+			counts[2][t.value&0xff]++
+			counts[3][t.value>>24]++
+		case 1:
+			counts[0][256+vp8lLengthCodes+int(t.value)]++
+		case 2:
+			symbol, _, _ := vp8lPrefix(t.value)
+			counts[0][256+symbol]++
+			symbol, _, _ = vp8lPrefix(t.distance)
+			counts[4][symbol]++
+		}
+	}
+
+	var codes [5]prefixCode
+	for i := range codes {
+		codes[i] = newPrefixCode(counts[i], vp8lMaxCodeLength)
+		codes[i].writeTo(w)
+	}
+
+	for _, t := range tokens {
+		switch t.kind {
+		case 0:
+			codes[0].emit(w, t.value>>8&0xff)
+			codes[1].emit(w, t.value>>16&0xff)
+			codes[2].emit(w, t.value&0xff)
+			codes[3].emit(w, t.value>>24)
+		case 1:
+			codes[0].emit(w, 256+vp8lLengthCodes+t.value)
+		case 2:
+			symbol, n, extra := vp8lPrefix(t.value)
+			codes[0].emit(w, 256+symbol)
+			w.write(extra, n)
+			symbol, n, extra = vp8lPrefix(t.distance)
+			codes[4].emit(w, symbol)
+			w.write(extra, n)
+		}
+	}
+}
+
+// prefixCode is a canonical Huffman code, with the codes bit reversed for
+// the least significant bit first writer
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+	// symbols in use, a code with one symbol takes no bits
+	used []int
+}
+
+func newPrefixCode(counts []int, limit int) prefixCode {
+	lengths := huffmanLengths(counts, limit)
+	pc := prefixCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+	for symbol, n := range lengths {
+		if n > 0 {
+			pc.used = append(pc.used, symbol)
+		}
+	}
+	if len(pc.used) < 2 {
+		return pc
+	}
+
+	// canonical codes, shorter first and in symbol order within a length
+	var perLength [vp8lMaxCodeLength + 1]uint32
+	for _, n := range lengths {
+		perLength[n]++
+	}
+	perLength[0] = 0
+	var next [vp8lMaxCodeLength + 1]uint32
+	code := uint32(0)
+	for n := 1; n <= vp8lMaxCodeLength; n++ {
+		code = (code + perLength[n-1]) << 1
+		next[n] = code
+	}
+	for symbol, n := range lengths {
+		if n > 0 {
+			pc.codes[symbol] = bits.Reverse32(next[n]) >> (32 - uint(n))
+			next[n]++
+		}
+	}
+	return pc
+}
+
+func (pc prefixCode) emit(w *bitWriter, symbol uint32) {
+	if len(pc.used) >= 2 {
+		w.write(pc.codes[symbol], uint(pc.lengths[symbol]))
+	}
+}
+
+// writeTo stores the code, as a simple code when it has at most two small
+// symbols and through run length coded code lengths otherwise
+func (pc prefixCode) writeTo(w *bitWriter) {
+	if len(pc.used) <= 2 && (len(pc.used) == 0 || pc.used[len(pc.used)-1] < 256) {
+		symbols := pc.used
+		if len(symbols) == 0 {
+			// an unused code still has to hold one symbol
+			symbols = []int{0}
+		}
+		w.write(1, 1)
+		w.write(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(symbols[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbols[0]), 8)
+		}
+		if len(symbols) == 2 {
+			w.write(uint32(symbols[1]), 8)
+		}
+		return
+	}
+
+	// runs of zeros and repeated lengths shrink the long alphabets
+	type run struct{ symbol, extra uint32 }
+	var runs []run
+	lengths := pc.lengths
+	for i := 0; i < len(lengths); {
+		n := lengths[i]
+		j := i
+		for j < len(lengths) && lengths[j] == n {
+			j++
+		}
+		count := j - i
+		if n == 0 {
+			for count >= 3 {
+				if count >= 11 {
+					c := min(count, 138)
+					runs = append(runs, run{18, uint32(c - 11)})
+					count -= c
+				} else {
+					c := min(count, 10)
+					runs = append(runs, run{17, uint32(c - 3)})
+					count -= c
+				}
+			}
+		} else {
+			runs = append(runs, run{uint32(n), 0})
+			count--
+			for count >= 3 {
+				c := min(count, 6)
+				runs = append(runs, run{16, uint32(c - 3)})
+				count -= c
+			}
+		}
+		for range count {
+			runs = append(runs, run{uint32(n), 0})
+		}
+		i = j
+	}
+
+	counts := make([]int, 19)
+	for _, r := range runs {
+		counts[r.symbol]++
+	}
+	lengthCode := newPrefixCode(counts, vp8lMaxLengthCodeLength)
+	stored := len(vp8lCodeLengthOrder)
+	for stored > 4 && lengthCode.lengths[vp8lCodeLengthOrder[stored-1]] == 0 {
+		stored--
+	}
+	w.write(0, 1)
+	w.write(uint32(stored-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:stored] {
+		w.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	// every symbol's length follows
+	w.write(0, 1)
+	extraBits := map[uint32]uint{16: 2, 17: 3, 18: 7}
+	for _, r := range runs {
+		lengthCode.emit(w, r.symbol)
+		if n, exists := extraBits[r.symbol]; exists {
+			w.write(r.extra, n)
+		}
+	}
+}
+
+// huffmanNode is a subtree of the code being built
+type huffmanNode struct {
+	count       int
+	symbol      int
+	left, right *huffmanNode
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].symbol < h[j].symbol
+}
+func (h huffmanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any)   { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffmanLengths builds code lengths of at most limit bits for the symbol
+// counts. Codes that come out too long are rebuilt with the rare symbols'
+// counts raised, which flattens the tree
+func huffmanLengths(counts []int, limit int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	used := 0
+	for _, c := range counts {
+		if c > 0 {
+			used++
+		}
+	}
+	if used == 1 {
+		lengths[slices.IndexFunc(counts, func(c int) bool { return c > 0 })] = 1
+		return lengths
+	}
+	if used == 0 {
+		return lengths
+	}
+
+	for floor := 1; ; floor *= 2 {
+		h := huffmanHeap{}
+		for symbol, c := range counts {
+			if c > 0 {
+				h = append(h, &huffmanNode{count: max(c, floor), symbol: symbol})
+			}
+		}
+		heap.Init(&h)
+		for h.Len() > 1 {
+			a, b := heap.Pop(&h).(*huffmanNode), heap.Pop(&h).(*huffmanNode)
+			heap.Push(&h, &huffmanNode{count: a.count + b.count, symbol: min(a.symbol, b.symbol), left: a, right: b})
+		}
+
+		deepest := 0
+		var walk func(n *huffmanNode, depth int)
+		walk = func(n *huffmanNode, depth int) {
+			if n.left == nil {
+				lengths[n.symbol] = uint8(depth)
+				deepest = max(deepest, depth)
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(h[0], 0)
+		if deepest <= limit {
+			return lengths
+		}
+	}
+}
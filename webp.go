@@ -0,0 +1,127 @@
+// WebP output, lossless stills and animations in the RIFF container
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+)
+
+// VP8X feature flags
+const (
+	webpAnimationFlag = 0x02
+	webpAlphaFlag     = 0x10
+)
+
+// ANMF frame flags, a frame either replaces its rectangle or is alpha
+// blended onto it, and stays on the canvas after its duration
+const webpNoBlend = 0x02
+
+// frame durations are 24 bit milliseconds
+const maxWebPDuration = 1<<24 - 1
+
+// appendChunk appends a RIFF chunk, padded to an even size
+func appendChunk(buf []byte, kind string, data []byte) []byte {
+	buf = append(buf, kind...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(data)))
+	buf = append(buf, data...)
+	if len(data)%2 == 1 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// appendUint24 appends the low 24 bits of v, least significant byte first
+func appendUint24(buf []byte, v int) []byte {
+	return append(buf, byte(v), byte(v>>8), byte(v>>16))
+}
+
+// writeWebP wraps the chunks in the RIFF header and writes the file
+func writeWebP(fileName string, chunks []byte) error {
+	riff := []byte("RIFF")
+	riff = binary.LittleEndian.AppendUint32(riff, uint32(4+len(chunks)))
+	riff = append(riff, "WEBP"...)
+	return os.WriteFile(fileName, append(riff, chunks...), 0o644)
+}
+
+// saveWebPImage writes a still image as a lossless WebP
+func saveWebPImage(img *image.RGBA, text, outputDir string) error {
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return err
+	}
+	data, err := encodeVP8L(img)
+	if err != nil {
+		return err
+	}
+
+	fileName := filepath.Join(outputDir, sanitizeFilename(text)+".webp")
+	if err := writeWebP(fileName, appendChunk(nil, "VP8L", data)); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Image successfully created: %s\n", fileName)
+	return nil
+}
+
+// saveAnimatedWebP writes the frames as a lossless animated WebP in the
+// configured playback order, keeping every color and the alpha channel like
+// APNG does in a fraction of the size
+func saveAnimatedWebP(frames, _ []*image.RGBA, delays []int, config Config, _ []color.RGBA, text string) error {
+	if err := os.MkdirAll(config.OutputDir, os.ModePerm); err != nil {
+		return err
+	}
+	canvas := frames[0].Rect
+	if canvas.Dx() > maxVP8LSize || canvas.Dy() > maxVP8LSize {
+		return fmt.Errorf("WebP images are at most %d pixels wide and high", maxVP8LSize)
+	}
+
+	order, delays := playbackOrder(delays, config)
+	var chunks []byte
+	alpha := false
+	for i, frame := range order {
+		// frame offsets are stored halved
+		img, over := frames[frame], false
+		if i > 0 && config.OptimizeFrames {
+			img, over = frameDelta(frames[order[i-1]], img, 2)
+		}
+		alpha = alpha || !img.Opaque()
+		data, err := encodeVP8L(img)
+		if err != nil {
+			return err
+		}
+
+		r := img.Rect.Sub(canvas.Min)
+		header := appendUint24(nil, r.Min.X/2)
+		header = appendUint24(header, r.Min.Y/2)
+		header = appendUint24(header, r.Dx()-1)
+		header = appendUint24(header, r.Dy()-1)
+		header = appendUint24(header, min(delays[i]*10, maxWebPDuration))
+		flags := byte(webpNoBlend)
+		if over {
+			flags = 0
+		}
+		header = append(header, flags)
+		chunks = appendChunk(chunks, "ANMF", appendChunk(header, "VP8L", data))
+	}
+
+	flags := uint32(webpAnimationFlag)
+	if alpha {
+		flags |= webpAlphaFlag
+	}
+	extended := binary.LittleEndian.AppendUint32(nil, flags)
+	extended = appendUint24(extended, canvas.Dx()-1)
+	extended = appendUint24(extended, canvas.Dy()-1)
+	// a transparent background color, then the loop count with 0 for forever
+	animation := binary.LittleEndian.AppendUint32(nil, 0)
+	animation = binary.LittleEndian.AppendUint16(animation, uint16(config.Loop))
+	header := appendChunk(appendChunk(nil, "VP8X", extended), "ANIM", animation)
+
+	fileName := filepath.Join(config.OutputDir, sanitizeFilename(text)+".webp")
+	if err := writeWebP(fileName, append(header, chunks...)); err != nil {
+		return err
+	}
+	fmt.Printf("✅ WebP animation successfully created: %s\n", fileName)
+	return nil
+}
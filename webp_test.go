@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// noiseImage fills a w by h image with random colors, opaque or with random
+// alpha
+func noiseImage(w, h int, seed uint64, opaque bool) *image.RGBA {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			c := color.NRGBA{uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256)), 255}
+			if !opaque {
+				c.A = uint8(rng.IntN(256))
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// straightPixels is img as the straight colors VP8L stores
+func straightPixels(img *image.RGBA) []uint8 {
+	var pix []uint8
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			argb := straightARGB(img.Pix[img.PixOffset(x, y):])
+			pix = append(pix, uint8(argb>>16), uint8(argb>>8), uint8(argb), uint8(argb>>24))
+		}
+	}
+	return pix
+}
+
+// decodeVP8L decodes a VP8L bitstream with golang.org/x/image/webp
+func decodeVP8L(t *testing.T, data []byte) *image.NRGBA {
+	t.Helper()
+	chunk := appendChunk(nil, "VP8L", data)
+	riff := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(4+len(chunk)))
+	riff = append(append(riff, "WEBP"...), chunk...)
+	img, err := webp.Decode(bytes.NewReader(riff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img.(*image.NRGBA)
+}
+
+func TestVP8LRoundTrip(t *testing.T) {
+	solid := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	fillRGBA(solid, color.RGBA{30, 144, 255, 255})
+	for name, img := range map[string]*image.RGBA{
+		"noise":       noiseImage(64, 64, 1, true),
+		"alpha noise": noiseImage(64, 64, 2, false),
+		"solid":       solid,
+		"transparent": image.NewRGBA(image.Rect(0, 0, 40, 30)),
+		"1x1":         noiseImage(1, 1, 3, false),
+		"odd sized":   noiseImage(37, 23, 4, false),
+		"offset":      noiseImage(50, 40, 5, true).SubImage(image.Rect(7, 3, 48, 38)).(*image.RGBA),
+		"background":  renderBackground(t, backgroundConfig("perlin-fbm", false), 173, 97, 1),
+	} {
+		data, err := encodeVP8L(img)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := decodeVP8L(t, data)
+		if got.Rect.Dx() != img.Rect.Dx() || got.Rect.Dy() != img.Rect.Dy() {
+			t.Errorf("%s decodes to %v, want %v", name, got.Rect.Size(), img.Rect.Size())
+			continue
+		}
+		if !bytes.Equal(got.Pix, straightPixels(img)) {
+			t.Errorf("%s doesn't decode to the pixels it was encoded from", name)
+		}
+	}
+}
+
+// webpChunk is a RIFF chunk of a WebP file
+type webpChunk struct {
+	kind string
+	data []byte
+}
+
+// readChunks splits data into RIFF chunks, checking every size
+func readChunks(t *testing.T, data []byte) []webpChunk {
+	t.Helper()
+	var chunks []webpChunk
+	for len(data) > 0 {
+		if len(data) < 8 {
+			t.Fatalf("%d stray bytes after the last chunk", len(data))
+		}
+		kind, size := string(data[:4]), int(binary.LittleEndian.Uint32(data[4:8]))
+		padded := size + size%2
+		if 8+padded > len(data) {
+			t.Fatalf("%s chunk of %d bytes overruns its container", kind, size)
+		}
+		chunks = append(chunks, webpChunk{kind, data[8 : 8+size]})
+		data = data[8+padded:]
+	}
+	return chunks
+}
+
+// the animation must parse back into frames that rebuild every input frame
+// when composited as the ANMF flags say
+func TestAnimatedWebPFrames(t *testing.T) {
+	const w, h = 41, 29
+	first := noiseImage(w, h, 6, true)
+	// a change at odd coordinates, which the frame offsets can't express
+	second := cloneImage(first)
+	for y := 5; y < 12; y++ {
+		for x := 7; x < 20; x++ {
+			second.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	// pixels turning transparent need the rectangle replaced
+	third := cloneImage(second)
+	for x := 3; x < 30; x++ {
+		third.SetRGBA(x, 21, color.RGBA{})
+	}
+	frames := []*image.RGBA{first, second, third}
+
+	config := Config{OutputDir: t.TempDir(), OptimizeFrames: true, PingPong: true}
+	if err := saveAnimatedWebP(frames, nil, []int{10, 20, 30}, config, nil, "anim"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(config.OutputDir, "anim.webp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		t.Fatal("missing RIFF WEBP header")
+	}
+	if size := int(binary.LittleEndian.Uint32(data[4:8])); size != len(data)-8 {
+		t.Fatalf("RIFF size %d, the file holds %d bytes after it", size, len(data)-8)
+	}
+	chunks := readChunks(t, data[12:])
+	if len(chunks) < 2 || chunks[0].kind != "VP8X" || chunks[1].kind != "ANIM" {
+		t.Fatal("the animation must start with VP8X and ANIM chunks")
+	}
+	vp8x := chunks[0].data
+	if vp8x[0]&webpAnimationFlag == 0 {
+		t.Error("VP8X lacks the animation flag")
+	}
+	canvasW := int(vp8x[4]) | int(vp8x[5])<<8 | int(vp8x[6])<<16 + 1
+	canvasH := int(vp8x[7]) | int(vp8x[8])<<8 | int(vp8x[9])<<16 + 1
+	if canvasW != w || canvasH != h {
+		t.Fatalf("canvas is %dx%d, want %dx%d", canvasW, canvasH, w, h)
+	}
+
+	// ping-pong plays the middle frame again on the way back
+	order := []int{0, 1, 2, 1}
+	anmf := chunks[2:]
+	if len(anmf) != len(order) {
+		t.Fatalf("%d frames, want %d", len(anmf), len(order))
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i, chunk := range anmf {
+		if chunk.kind != "ANMF" {
+			t.Fatalf("chunk %d is %s, want ANMF", i+2, chunk.kind)
+		}
+		u24 := func(o int) int { return int(chunk.data[o]) | int(chunk.data[o+1])<<8 | int(chunk.data[o+2])<<16 }
+		// offsets are stored halved, so frames can only start at even pixels
+		x, y := 2*u24(0), 2*u24(3)
+		fw, fh := u24(6)+1, u24(9)+1
+		blend := chunk.data[15]&webpNoBlend == 0
+		if x+fw > w || y+fh > h {
+			t.Fatalf("frame %d at %d,%d of %dx%d leaves the canvas", i, x, y, fw, fh)
+		}
+		inner := readChunks(t, chunk.data[16:])
+		if len(inner) != 1 || inner[0].kind != "VP8L" {
+			t.Fatalf("frame %d must hold one VP8L chunk", i)
+		}
+		img := decodeVP8L(t, inner[0].data)
+		if img.Rect.Dx() != fw || img.Rect.Dy() != fh {
+			t.Fatalf("frame %d decodes to %v, its header says %dx%d", i, img.Rect.Size(), fw, fh)
+		}
+		for py := range fh {
+			for px := range fw {
+				c := img.NRGBAAt(px, py)
+				if blend && c.A == 0 {
+					continue
+				}
+				if blend && c.A != 255 {
+					t.Fatalf("frame %d blends a partly transparent pixel", i)
+				}
+				canvas.SetNRGBA(x+px, y+py, c)
+			}
+		}
+		if !bytes.Equal(canvas.Pix, straightPixels(frames[order[i]])) {
+			t.Errorf("frame %d doesn't rebuild input frame %d", i, order[i])
+		}
+	}
+}